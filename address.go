@@ -0,0 +1,114 @@
+package gobot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+Addressing is a way of directing a message at the bot, such as mentioning
+it at the start of the message or prefixing a command with "!". A message
+in a channel only reaches the command registry if it matches one of the
+bot's addressings, and the matched address is stripped before the text is
+handed to commands. Direct messages don't need to be addressed.
+
+Use WithAddressing to choose the addressings for all channels and
+WithChannelAddressing to override them for particular channels. The
+default is MentionPrefix alone.
+*/
+type Addressing interface {
+	// compile builds the regexp matching this address for a bot with the given identity.
+	compile(selfID, selfName string) (*regexp.Regexp, error)
+}
+
+// addressPattern is an Addressing built from a regexp template.
+type addressPattern struct {
+	name   string
+	format func(selfID, selfName string) string
+}
+
+func (a addressPattern) compile(selfID, selfName string) (*regexp.Regexp, error) {
+	pattern := a.format(selfID, selfName)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf(`Unable to compile regexp from "%s" for %s: %s`, pattern, a.name, err)
+	}
+	return re, nil
+}
+
+var (
+	// MentionPrefix matches an @mention of the bot at the start of the message, eg. "@gobot: deploy".
+	MentionPrefix Addressing = addressPattern{"MentionPrefix", func(id, name string) string {
+		return fmt.Sprintf(`^<@%s>:?\s*`, regexp.QuoteMeta(id))
+	}}
+
+	// MentionAnywhere matches an @mention of the bot anywhere in the message, eg. "deploy please @gobot".
+	MentionAnywhere Addressing = addressPattern{"MentionAnywhere", func(id, name string) string {
+		return fmt.Sprintf(`\s*<@%s>[:,]?\s*`, regexp.QuoteMeta(id))
+	}}
+
+	// NamePrefix matches the bot's name typed as plain text at the start of the message, eg. "gobot: deploy".
+	NamePrefix Addressing = addressPattern{"NamePrefix", func(id, name string) string {
+		return fmt.Sprintf(`(?i)^@?%s(?:[:,]\s*|\s+)`, regexp.QuoteMeta(name))
+	}}
+)
+
+// Sigil matches a fixed prefix at the start of the message, eg. Sigil("!") for "!deploy".
+func Sigil(prefix string) Addressing {
+	return addressPattern{"Sigil", func(id, name string) string {
+		return fmt.Sprintf(`^%s\s*`, regexp.QuoteMeta(prefix))
+	}}
+}
+
+/*
+compileAddressings builds the bot's address matchers once its identity is
+known.
+*/
+func (b *Bot) compileAddressings() error {
+	compile := func(modes []Addressing) ([]*regexp.Regexp, error) {
+		res := make([]*regexp.Regexp, 0, len(modes))
+		for _, mode := range modes {
+			re, err := mode.compile(b.selfID, b.selfName)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		return res, nil
+	}
+
+	addresses, err := compile(b.addressings)
+	if err != nil {
+		return err
+	}
+
+	channelAddresses := make(map[string][]*regexp.Regexp)
+	for channel, modes := range b.channelAddressings {
+		if channelAddresses[channel], err = compile(modes); err != nil {
+			return err
+		}
+	}
+
+	b.addresses = addresses
+	b.channelAddresses = channelAddresses
+	return nil
+}
+
+/*
+address checks whether text, posted in channel, is addressed to the bot.
+It returns the text with the address removed.
+*/
+func (b *Bot) address(channel, text string) (string, bool) {
+	addresses, ok := b.channelAddresses[channel]
+	if !ok {
+		addresses = b.addresses
+	}
+
+	for _, re := range addresses {
+		if loc := re.FindStringIndex(text); loc != nil {
+			return strings.TrimSpace(text[:loc[0]] + " " + text[loc[1]:]), true
+		}
+	}
+	return text, false
+}
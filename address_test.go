@@ -0,0 +1,43 @@
+package gobot
+
+import (
+	"testing"
+)
+
+func TestAddressings(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"),
+		WithAddressing(MentionPrefix, MentionAnywhere, NamePrefix, Sigil("!")),
+		WithChannelAddressing("C2", Sigil(".")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.setIdentity(&Identity{ID: "U0BOT", Name: "gobot"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		channel, text string
+		want          string
+		addressed     bool
+	}{
+		{"C1", "<@U0BOT>: deploy", "deploy", true},
+		{"C1", "deploy now <@U0BOT>", "deploy now", true},
+		{"C1", "gobot: deploy", "deploy", true},
+		{"C1", "GoBot deploy", "deploy", true},
+		{"C1", "@gobot deploy", "deploy", true},
+		{"C1", "!deploy", "deploy", true},
+		{"C1", "gobotron deploy", "gobotron deploy", false},
+		{"C1", "deploy", "deploy", false},
+		{"C2", ".deploy", "deploy", true},
+		{"C2", "!deploy", "!deploy", false},
+		{"C2", "<@U0BOT> deploy", "<@U0BOT> deploy", false},
+	}
+
+	for _, c := range cases {
+		got, addressed := b.address(c.channel, c.text)
+		if got != c.want || addressed != c.addressed {
+			t.Errorf("address(%q, %q) = %q, %v; want %q, %v", c.channel, c.text, got, addressed, c.want, c.addressed)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+/*
+Package blocks builds Slack Block Kit layouts for gobot messages.
+
+Blocks are assembled with a Builder, which checks Slack's limits (at most
+50 blocks per message, 3000 characters of section text, 10 section fields,
+and so on) when Build is called rather than leaving Slack to reject the
+message at send time:
+
+	bl, err := blocks.New().
+		Section(blocks.Markdown("*Deploy finished*")).
+		Divider().
+		Fields(blocks.Markdown("*App*\nweb"), blocks.Markdown("*Env*\nprod")).
+		Actions(blocks.NewButton("rollback", blocks.Plain("Roll back")).WithStyle(blocks.Danger)).
+		Build()
+
+The resulting slice can be assigned to gobot.SlackMessage.Blocks, or
+Builder.Message can build the SlackMessage directly.
+*/
+package blocks
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Limits imposed by Slack on Block Kit payloads.
+const (
+	MaxBlocks          = 50
+	MaxSectionText     = 3000
+	MaxSectionFields   = 10
+	MaxFieldText       = 2000
+	MaxContextElements = 10
+	MaxActionElements  = 25
+	MaxBlockID         = 255
+	MaxHeaderText      = 150
+	MaxImageAltText    = 2000
+	MaxImageTitle      = 2000
+)
+
+/*
+Block is a single top-level layout block. Blocks marshal to the JSON that
+Slack expects, including their "type".
+*/
+type Block interface {
+	json.Marshaler
+	validate() error
+}
+
+// Section is a block of text, optionally with fields and an accessory element.
+type Section struct {
+	Text      *Text
+	Fields    []*Text
+	Accessory Element
+	BlockID   string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *Section) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type      string  `json:"type"`
+		Text      *Text   `json:"text,omitempty"`
+		Fields    []*Text `json:"fields,omitempty"`
+		Accessory Element `json:"accessory,omitempty"`
+		BlockID   string  `json:"block_id,omitempty"`
+	}{"section", s.Text, s.Fields, s.Accessory, s.BlockID})
+}
+
+func (s *Section) validate() error {
+	if s.Text == nil && len(s.Fields) == 0 {
+		return fmt.Errorf("section: needs text or fields")
+	}
+	if err := s.Text.validate("section text", MaxSectionText, false); err != nil {
+		return err
+	}
+	if len(s.Fields) > MaxSectionFields {
+		return fmt.Errorf("section: %d fields, the limit is %d", len(s.Fields), MaxSectionFields)
+	}
+	for _, f := range s.Fields {
+		if err := f.validate("section field", MaxFieldText, false); err != nil {
+			return err
+		}
+	}
+	if s.Accessory != nil {
+		if err := s.Accessory.validate(); err != nil {
+			return err
+		}
+	}
+	return validateBlockID(s.BlockID)
+}
+
+// Divider is a horizontal rule.
+type Divider struct {
+	BlockID string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d *Divider) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type    string `json:"type"`
+		BlockID string `json:"block_id,omitempty"`
+	}{"divider", d.BlockID})
+}
+
+func (d *Divider) validate() error {
+	return validateBlockID(d.BlockID)
+}
+
+// Header is a large plain_text heading.
+type Header struct {
+	Text    *Text
+	BlockID string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (h *Header) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type    string `json:"type"`
+		Text    *Text  `json:"text"`
+		BlockID string `json:"block_id,omitempty"`
+	}{"header", h.Text, h.BlockID})
+}
+
+func (h *Header) validate() error {
+	if h.Text == nil {
+		return fmt.Errorf("header: needs text")
+	}
+	if err := h.Text.validate("header text", MaxHeaderText, true); err != nil {
+		return err
+	}
+	return validateBlockID(h.BlockID)
+}
+
+/*
+Context displays small, muted text and images. Elements must be *Text or
+*Image values.
+*/
+type Context struct {
+	Elements []interface{}
+	BlockID  string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c *Context) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string        `json:"type"`
+		Elements []interface{} `json:"elements"`
+		BlockID  string        `json:"block_id,omitempty"`
+	}{"context", c.Elements, c.BlockID})
+}
+
+func (c *Context) validate() error {
+	if len(c.Elements) == 0 {
+		return fmt.Errorf("context: needs at least one element")
+	}
+	if len(c.Elements) > MaxContextElements {
+		return fmt.Errorf("context: %d elements, the limit is %d", len(c.Elements), MaxContextElements)
+	}
+	for _, e := range c.Elements {
+		switch e := e.(type) {
+		case *Text:
+			if err := e.validate("context text", MaxSectionText, false); err != nil {
+				return err
+			}
+		case *Image:
+			if err := e.validateElement(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("context: unsupported element %T", e)
+		}
+	}
+	return validateBlockID(c.BlockID)
+}
+
+// Actions holds interactive elements such as buttons and select menus.
+type Actions struct {
+	Elements []Element
+	BlockID  string
+}
+
+// MarshalJSON implements json.Marshaler.
+func (a *Actions) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string    `json:"type"`
+		Elements []Element `json:"elements"`
+		BlockID  string    `json:"block_id,omitempty"`
+	}{"actions", a.Elements, a.BlockID})
+}
+
+func (a *Actions) validate() error {
+	if len(a.Elements) == 0 {
+		return fmt.Errorf("actions: needs at least one element")
+	}
+	if len(a.Elements) > MaxActionElements {
+		return fmt.Errorf("actions: %d elements, the limit is %d", len(a.Elements), MaxActionElements)
+	}
+	for _, e := range a.Elements {
+		if err := e.validate(); err != nil {
+			return err
+		}
+	}
+	return validateBlockID(a.BlockID)
+}
+
+/*
+Image is an image, usable both as a top-level block (with an optional
+Title) and as an element in a Context or Section accessory.
+*/
+type Image struct {
+	ImageURL string
+	AltText  string
+	Title    *Text
+	BlockID  string
+}
+
+// NewImage returns an Image of the given URL.
+func NewImage(imageURL, altText string) *Image {
+	return &Image{ImageURL: imageURL, AltText: altText}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (i *Image) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string `json:"type"`
+		ImageURL string `json:"image_url"`
+		AltText  string `json:"alt_text"`
+		Title    *Text  `json:"title,omitempty"`
+		BlockID  string `json:"block_id,omitempty"`
+	}{"image", i.ImageURL, i.AltText, i.Title, i.BlockID})
+}
+
+func (i *Image) validate() error {
+	if err := i.validateElement(); err != nil {
+		return err
+	}
+	if err := i.Title.validate("image title", MaxImageTitle, true); err != nil {
+		return err
+	}
+	return validateBlockID(i.BlockID)
+}
+
+func (i *Image) validateElement() error {
+	if i.ImageURL == "" {
+		return fmt.Errorf("image: needs a URL")
+	}
+	if i.AltText == "" {
+		return fmt.Errorf("image: needs alt text")
+	}
+	if n := len([]rune(i.AltText)); n > MaxImageAltText {
+		return fmt.Errorf("image: alt text is %d characters, the limit is %d", n, MaxImageAltText)
+	}
+	return nil
+}
+
+func validateBlockID(id string) error {
+	if len(id) > MaxBlockID {
+		return fmt.Errorf("block_id %q is longer than %d characters", id, MaxBlockID)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package blocks
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBuildMarshalsBlockKit(t *testing.T) {
+	bl, err := New().
+		Header("Deploy").
+		Section(Markdown("*Deploy finished*")).
+		Divider().
+		Fields(Markdown("*App*\nweb"), Markdown("*Env*\nprod")).
+		Context(Plain("by gobot"), NewImage("https://example.com/i.png", "icon")).
+		Actions(
+			NewButton("rollback", Plain("Roll back")).WithValue("web").WithStyle(Danger),
+			NewStaticSelect("env", Plain("Pick one"), NewOption("Prod", "prod")),
+		).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded []map[string]interface{}
+	json.Unmarshal(raw, &decoded)
+
+	types := []string{"header", "section", "divider", "section", "context", "actions"}
+	if len(decoded) != len(types) {
+		t.Fatalf("Expected %d blocks, got %s", len(types), raw)
+	}
+	for i, typ := range types {
+		if decoded[i]["type"] != typ {
+			t.Errorf("Block %d: expected type %s, got %v", i, typ, decoded[i]["type"])
+		}
+	}
+
+	button := decoded[5]["elements"].([]interface{})[0].(map[string]interface{})
+	if button["action_id"] != "rollback" || button["style"] != "danger" || button["value"] != "web" {
+		t.Errorf("Unexpected button: %v", button)
+	}
+}
+
+func TestBuildValidatesLimits(t *testing.T) {
+	tooMany := New()
+	for i := 0; i <= MaxBlocks; i++ {
+		tooMany.Divider()
+	}
+
+	fields := make([]*Text, MaxSectionFields+1)
+	for i := range fields {
+		fields[i] = Plain("f")
+	}
+
+	cases := map[string]*Builder{
+		"empty":           New(),
+		"too many blocks": tooMany,
+		"long text":       New().Section(Markdown(strings.Repeat("a", MaxSectionText+1))),
+		"too many fields": New().Fields(fields...),
+		"mrkdwn button":   New().Actions(NewButton("b", Markdown("*no*"))),
+		"no action id":    New().Actions(NewButton("", Plain("ok"))),
+		"bad style":       New().Actions(NewButton("b", Plain("ok")).WithStyle("loud")),
+		"no options":      New().Actions(NewStaticSelect("s", Plain("pick"))),
+		"image alt":       New().Image("https://example.com/i.png", ""),
+	}
+
+	for name, b := range cases {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: expected a validation error", name)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	msg, err := New().Section(Plain("hi")).Message("C1", "hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Channel != "C1" || msg.Text != "hi" || msg.Blocks == nil {
+		t.Errorf("Unexpected message: %+v", msg)
+	}
+}
@@ -0,0 +1,101 @@
+package blocks
+
+import (
+	"fmt"
+	"github.com/jlindsey/gobot"
+)
+
+/*
+Builder accumulates blocks for a single message. Its methods return the
+Builder so calls can be chained; nothing is validated until Build.
+*/
+type Builder struct {
+	blocks []Block
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Add appends arbitrary blocks.
+func (b *Builder) Add(blocks ...Block) *Builder {
+	b.blocks = append(b.blocks, blocks...)
+	return b
+}
+
+// Section appends a section of text.
+func (b *Builder) Section(text *Text) *Builder {
+	return b.Add(&Section{Text: text})
+}
+
+// SectionWithAccessory appends a section of text with an element beside it.
+func (b *Builder) SectionWithAccessory(text *Text, accessory Element) *Builder {
+	return b.Add(&Section{Text: text, Accessory: accessory})
+}
+
+// Fields appends a section laid out as a two-column grid of fields.
+func (b *Builder) Fields(fields ...*Text) *Builder {
+	return b.Add(&Section{Fields: fields})
+}
+
+// Header appends a plain_text header.
+func (b *Builder) Header(text string) *Builder {
+	return b.Add(&Header{Text: Plain(text)})
+}
+
+// Divider appends a horizontal rule.
+func (b *Builder) Divider() *Builder {
+	return b.Add(&Divider{})
+}
+
+// Context appends a context block of *Text and *Image elements.
+func (b *Builder) Context(elements ...interface{}) *Builder {
+	return b.Add(&Context{Elements: elements})
+}
+
+// Actions appends a block of interactive elements.
+func (b *Builder) Actions(elements ...Element) *Builder {
+	return b.Add(&Actions{Elements: elements})
+}
+
+// Image appends an image block.
+func (b *Builder) Image(imageURL, altText string) *Builder {
+	return b.Add(NewImage(imageURL, altText))
+}
+
+/*
+Build validates the accumulated blocks against Slack's limits and returns
+them. The error names the first offending block.
+*/
+func (b *Builder) Build() ([]Block, error) {
+	if len(b.blocks) == 0 {
+		return nil, fmt.Errorf("blocks: message has no blocks")
+	}
+	if len(b.blocks) > MaxBlocks {
+		return nil, fmt.Errorf("blocks: message has %d blocks, the limit is %d", len(b.blocks), MaxBlocks)
+	}
+
+	for i, block := range b.blocks {
+		if err := block.validate(); err != nil {
+			return nil, fmt.Errorf("blocks: block %d: %s", i, err)
+		}
+	}
+
+	return append([]Block(nil), b.blocks...), nil
+}
+
+/*
+Message builds the blocks into a SlackMessage for channel. text is the
+plain-text fallback shown in notifications.
+*/
+func (b *Builder) Message(channel, text string) (*gobot.SlackMessage, error) {
+	blocks, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	msg := gobot.NewSlackMessage(channel, text)
+	msg.Blocks = blocks
+	return msg, nil
+}
@@ -0,0 +1,209 @@
+package blocks
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Limits imposed by Slack on interactive elements.
+const (
+	MaxActionID      = 255
+	MaxButtonText    = 75
+	MaxButtonValue   = 2000
+	MaxOptions       = 100
+	MaxOptionText    = 75
+	MaxOptionValue   = 75
+	MaxPlaceholder   = 150
+	MaxConfirmTitle  = 100
+	MaxConfirmText   = 300
+	MaxConfirmButton = 30
+)
+
+// Button styles.
+const (
+	Primary = "primary"
+	Danger  = "danger"
+)
+
+/*
+Element is an interactive element that can be placed in an Actions block
+or as a Section accessory. Clicking one sends Slack an interaction payload
+carrying its ActionID.
+*/
+type Element interface {
+	json.Marshaler
+	validate() error
+}
+
+// Button is a clickable button.
+type Button struct {
+	ActionID string
+	Text     *Text
+	Value    string
+	URL      string
+	Style    string
+	Confirm  *Confirm
+}
+
+// NewButton returns a Button with the given action ID and label.
+func NewButton(actionID string, text *Text) *Button {
+	return &Button{ActionID: actionID, Text: text}
+}
+
+// WithValue sets the value sent with the click and returns the button.
+func (b *Button) WithValue(value string) *Button {
+	b.Value = value
+	return b
+}
+
+// WithStyle sets the button style (Primary or Danger) and returns the button.
+func (b *Button) WithStyle(style string) *Button {
+	b.Style = style
+	return b
+}
+
+// WithConfirm asks the user to confirm before the click is sent and returns the button.
+func (b *Button) WithConfirm(c *Confirm) *Button {
+	b.Confirm = c
+	return b
+}
+
+// MarshalJSON implements json.Marshaler.
+func (b *Button) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string   `json:"type"`
+		ActionID string   `json:"action_id"`
+		Text     *Text    `json:"text"`
+		Value    string   `json:"value,omitempty"`
+		URL      string   `json:"url,omitempty"`
+		Style    string   `json:"style,omitempty"`
+		Confirm  *Confirm `json:"confirm,omitempty"`
+	}{"button", b.ActionID, b.Text, b.Value, b.URL, b.Style, b.Confirm})
+}
+
+func (b *Button) validate() error {
+	if err := validateActionID(b.ActionID); err != nil {
+		return err
+	}
+	if b.Text == nil {
+		return fmt.Errorf("button %s: needs text", b.ActionID)
+	}
+	if err := b.Text.validate("button text", MaxButtonText, true); err != nil {
+		return err
+	}
+	if len(b.Value) > MaxButtonValue {
+		return fmt.Errorf("button %s: value is longer than %d characters", b.ActionID, MaxButtonValue)
+	}
+	if b.Style != "" && b.Style != Primary && b.Style != Danger {
+		return fmt.Errorf("button %s: unknown style %q", b.ActionID, b.Style)
+	}
+	return b.Confirm.validate()
+}
+
+// StaticSelect is a select menu with a fixed list of options.
+type StaticSelect struct {
+	ActionID      string
+	Placeholder   *Text
+	Options       []*Option
+	InitialOption *Option
+	Confirm       *Confirm
+}
+
+// NewStaticSelect returns a select menu with the given action ID, placeholder and options.
+func NewStaticSelect(actionID string, placeholder *Text, options ...*Option) *StaticSelect {
+	return &StaticSelect{ActionID: actionID, Placeholder: placeholder, Options: options}
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s *StaticSelect) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type          string    `json:"type"`
+		ActionID      string    `json:"action_id"`
+		Placeholder   *Text     `json:"placeholder"`
+		Options       []*Option `json:"options"`
+		InitialOption *Option   `json:"initial_option,omitempty"`
+		Confirm       *Confirm  `json:"confirm,omitempty"`
+	}{"static_select", s.ActionID, s.Placeholder, s.Options, s.InitialOption, s.Confirm})
+}
+
+func (s *StaticSelect) validate() error {
+	if err := validateActionID(s.ActionID); err != nil {
+		return err
+	}
+	if s.Placeholder == nil {
+		return fmt.Errorf("select %s: needs a placeholder", s.ActionID)
+	}
+	if err := s.Placeholder.validate("select placeholder", MaxPlaceholder, true); err != nil {
+		return err
+	}
+	if len(s.Options) == 0 || len(s.Options) > MaxOptions {
+		return fmt.Errorf("select %s: has %d options, needs 1 to %d", s.ActionID, len(s.Options), MaxOptions)
+	}
+	for _, o := range s.Options {
+		if err := o.validate(); err != nil {
+			return err
+		}
+	}
+	return s.Confirm.validate()
+}
+
+// Option is a single choice in a select menu.
+type Option struct {
+	Text  *Text  `json:"text"`
+	Value string `json:"value"`
+}
+
+// NewOption returns an Option with a plain_text label.
+func NewOption(text, value string) *Option {
+	return &Option{Text: Plain(text), Value: value}
+}
+
+func (o *Option) validate() error {
+	if o.Text == nil {
+		return fmt.Errorf("option %q: needs text", o.Value)
+	}
+	if err := o.Text.validate("option text", MaxOptionText, false); err != nil {
+		return err
+	}
+	if o.Value == "" || len(o.Value) > MaxOptionValue {
+		return fmt.Errorf("option %q: value must be 1 to %d characters", o.Value, MaxOptionValue)
+	}
+	return nil
+}
+
+// Confirm is a dialog asking the user to confirm an action.
+type Confirm struct {
+	Title   *Text `json:"title"`
+	Text    *Text `json:"text"`
+	Confirm *Text `json:"confirm"`
+	Deny    *Text `json:"deny"`
+}
+
+func (c *Confirm) validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Title == nil || c.Text == nil || c.Confirm == nil || c.Deny == nil {
+		return fmt.Errorf("confirm: needs title, text, confirm and deny")
+	}
+	if err := c.Title.validate("confirm title", MaxConfirmTitle, true); err != nil {
+		return err
+	}
+	if err := c.Text.validate("confirm text", MaxConfirmText, false); err != nil {
+		return err
+	}
+	if err := c.Confirm.validate("confirm button", MaxConfirmButton, true); err != nil {
+		return err
+	}
+	return c.Deny.validate("deny button", MaxConfirmButton, true)
+}
+
+func validateActionID(id string) error {
+	if id == "" {
+		return fmt.Errorf("element: needs an action_id")
+	}
+	if len(id) > MaxActionID {
+		return fmt.Errorf("action_id %q is longer than %d characters", id, MaxActionID)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package blocks
+
+import (
+	"fmt"
+)
+
+// Text object types.
+const (
+	PlainText = "plain_text"
+	Mrkdwn    = "mrkdwn"
+)
+
+/*
+Text is a Block Kit text composition object, either plain_text or mrkdwn.
+Use Plain or Markdown to create one.
+*/
+type Text struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Emoji    bool   `json:"emoji,omitempty"`
+	Verbatim bool   `json:"verbatim,omitempty"`
+}
+
+// Plain returns a plain_text object with emoji shortcodes enabled.
+func Plain(text string) *Text {
+	return &Text{Type: PlainText, Text: text, Emoji: true}
+}
+
+// Markdown returns a mrkdwn text object.
+func Markdown(text string) *Text {
+	return &Text{Type: Mrkdwn, Text: text}
+}
+
+// validate checks the text against maxLen and, if plainOnly, that it is plain_text.
+func (t *Text) validate(field string, maxLen int, plainOnly bool) error {
+	if t == nil {
+		return nil
+	}
+	if t.Type != PlainText && t.Type != Mrkdwn {
+		return fmt.Errorf("%s: unknown text type %q", field, t.Type)
+	}
+	if plainOnly && t.Type != PlainText {
+		return fmt.Errorf("%s: must be %s", field, PlainText)
+	}
+	if t.Text == "" {
+		return fmt.Errorf("%s: text is empty", field)
+	}
+	if n := len([]rune(t.Text)); n > maxLen {
+		return fmt.Errorf("%s: text is %d characters, the limit is %d", field, n, maxLen)
+	}
+	return nil
+}
@@ -2,34 +2,34 @@
 
 The Gobot package comprises a library for implementing a Slack bot in Go.
 Implementing packages should acquire a pointer to a bot by calling NewBot,
-add commands and listeners with RegisterCommand, and finally call Start when
+add commands and listeners with RegisterCommand or RegisterHandler, and finally call Start when
 setup is complete to connect to Slack and start processing messages.*/
 package gobot
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/Jeffail/gabs"
 	"github.com/gorilla/websocket"
-	"io/ioutil"
+	"github.com/op/go-logging"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	apiTokenEnvKey         = "SLACK_API_TOKEN"
-	apiRTMStartEndpoint    = "https://slack.com/api/rtm.start"
+	defaultAPIBaseURL      = "https://slack.com/api/"
 	messageQueueBufferSize = 10
-)
-
-var (
-	done        = make(chan bool)
-	outgoingSem = make(chan int, 1)
-	msgPrefix   *regexp.Regexp
+	commandQueueBufferSize = 5
+	defaultShutdownTimeout = 10 * time.Second
+	idlePollInterval       = 10 * time.Millisecond
 )
 
 /*
@@ -37,227 +37,477 @@ Bot is the primary type of the package, encapsulating the configuration,
 connections, and state of the bot.
 */
 type Bot struct {
-	apiToken  string
-	socketURL *url.URL
-	conn      *websocket.Conn
-	selfName  string
-	selfID    string
-	teamName  string
+	api       *slackClient
+	transport Transport
+	log       *logging.Logger
+
+	selfName string
+	selfID   string
+	teamName string
+
+	addressings        []Addressing
+	channelAddressings map[string][]Addressing
+	addresses          []*regexp.Regexp
+	channelAddresses   map[string][]*regexp.Regexp
 
-	commands []Command
-	helps    map[string]*help
+	routes    []*Route
+	listeners []*Listener
+	actions   map[string]ActionHandler
+	helps     map[string]*help
+
+	signingSecret string
 
 	sendQueue    chan *SlackMessage
-	messageQueue chan *gabs.Container
+	messageQueue chan *IncomingMessage
 	commandQueue chan func()
+
+	shutdownTimeout  time.Duration
+	inflightCommands sync.WaitGroup
+	inflightSends    sync.WaitGroup
+	handlingMessages int32
+	runningCommands  int32
+	pendingSends     int32
+	sendCtx          context.Context
+	cancelSends      context.CancelFunc
+
+	threadedReplyLength int
+	privateHelp         bool
+	botPolicy           BotPolicy
+	allowedBots         map[string]bool
+
+	transportFailed chan error
+
+	// ctx is cancelled when the bot begins shutting down. It exists from NewBot on, since HTTP handlers may use it before Start.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	started  int32
+	done     chan struct{}
+	stopOnce sync.Once
+	finished chan struct{}
+	err      error
 }
 
 // String implements the Stringer interface.
-func (b Bot) String() string {
+func (b *Bot) String() string {
 	return fmt.Sprintf("Bot{team: %s, name: %s, id: %s}", b.teamName, b.selfName, b.selfID)
 }
 
-// NewBot instantiates and returns a new Bot struct.
-func NewBot() *Bot {
-	token := getAPITokenOrDie()
+/*
+NewBot instantiates and returns a new Bot struct configured by opts.
+See the With* functions for the available options.
+
+Unless WithToken is given, the Slack API token is read from the
+SLACK_API_TOKEN environment variable, and a *MissingTokenError is
+returned if it isn't set. The token isn't needed if the bot is given a
+Transport of its own with WithTransport.
+*/
+func NewBot(opts ...Option) (*Bot, error) {
+	cfg := config{
+		apiBaseURL:       defaultAPIBaseURL,
+		httpClient:       http.DefaultClient,
+		dialer:           websocket.DefaultDialer,
+		logger:           Log,
+		sendQueueSize:    messageQueueBufferSize,
+		messageQueueSize: messageQueueBufferSize,
+		commandQueueSize: commandQueueBufferSize,
+		reconnectPolicy:  DefaultReconnectPolicy,
+		shutdownTimeout:  defaultShutdownTimeout,
+
+		addressings:        []Addressing{MentionPrefix},
+		channelAddressings: make(map[string][]Addressing),
+		pingInterval:       defaultPingInterval,
+		maxMissedPongs:     defaultMaxMissed,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	token := cfg.token
+	if token == "" {
+		token = os.Getenv(apiTokenEnvKey)
+	}
+
+	baseURL, err := url.Parse(cfg.apiBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse API base URL %q: %s", cfg.apiBaseURL, err)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	api := &slackClient{token: token, baseURL: baseURL, httpClient: cfg.httpClient, log: cfg.logger}
+
+	transport := cfg.transport
+	if transport == nil {
+		if transport, err = newSlackTransport(api, &cfg); err != nil {
+			return nil, err
+		}
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	sendCtx, cancelSends := context.WithCancel(context.Background())
 	bot := Bot{
-		apiToken:     token,
-		commands:     make([]Command, 0, 10),
+		api:       api,
+		transport: transport,
+		log:       cfg.logger,
+
+		routes:       make([]*Route, 0, 10),
+		actions:      make(map[string]ActionHandler),
 		helps:        make(map[string]*help),
-		sendQueue:    make(chan *SlackMessage, messageQueueBufferSize),
-		messageQueue: make(chan *gabs.Container, messageQueueBufferSize),
-		commandQueue: make(chan func(), 5),
+		sendQueue:    make(chan *SlackMessage, cfg.sendQueueSize),
+		messageQueue: make(chan *IncomingMessage, cfg.messageQueueSize),
+		commandQueue: make(chan func(), cfg.commandQueueSize),
+
+		ctx:             ctx,
+		cancel:          cancel,
+		shutdownTimeout: cfg.shutdownTimeout,
+		sendCtx:         sendCtx,
+		cancelSends:     cancelSends,
+
+		threadedReplyLength: cfg.threadedReplyLength,
+		privateHelp:         cfg.privateHelp,
+		signingSecret:       cfg.signingSecret,
+
+		addressings:        cfg.addressings,
+		channelAddressings: cfg.channelAddressings,
+
+		botPolicy:   cfg.botPolicy,
+		allowedBots: make(map[string]bool),
+
+		transportFailed: make(chan error),
+
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	for _, id := range cfg.allowedBots {
+		bot.allowedBots[id] = true
 	}
 
-	return &bot
+	return &bot, nil
 }
 
 /*
-Start initiates the Slack RTM sign-on process and connects to the
-websocket. It starts the various goroutines and listeners that
-comprise the bot's functionality.
+Start connects the bot's transport, by default initiating the Slack RTM
+sign-on process and connecting to the websocket. It starts the various
+goroutines and listeners that comprise the bot's functionality. Bots
+created with WithEventsAPI identify themselves with auth.test instead and
+receive messages through EventsHandler; bots created with WithSocketMode
+do the same but receive them over a Socket Mode websocket.
 
 This method starts the main run loop for the bot and so blocks
-until exit conditions are met (interrupt signal caught, error arrises, etc).
-Therefore, this method should not be called by implementing packages until
-the bot setup is complete and all commands are registered.
+until exit conditions are met (ctx cancelled, Stop called, interrupt
+signal caught, error arrises, etc). Therefore, this method should not be
+called by implementing packages until the bot setup is complete and all
+commands are registered. A bot can only be started once.
+
+The context passed to ContextCommands is cancelled when the bot begins
+shutting down, including when ctx is cancelled.
+
+Start returns nil after a graceful shutdown, or a *ShutdownError if
+running commands or queued messages had to be abandoned. Startup failures are returned
+as one of *HTTPError, *SlackError or *DialError so callers can decide
+whether to retry; other transports return errors of their own. If the
+transport's connection fails for good, Start returns its error. If its
+input simply ends, as with a ConsoleTransport reading a script, the bot
+finishes handling what it has received and then stops gracefully.
 */
-func (b *Bot) Start() {
-	Log.Info("Hello! Starting up...")
+func (b *Bot) Start(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&b.started, 0, 1) {
+		return errors.New("Bot has already been started")
+	}
 
-	b.extractHelps()
-	b.callSlackStartRTM()
-	b.startSlackWebsocket()
-	b.runMainLoop()
+	err := b.run(ctx)
+
+	b.err = err
+	close(b.finished)
+	return err
 }
 
 /*
-RegisterCommand adds a new command to the internal commands
-registry of the bot. This will allow those commands to be
-triggered by messages. See the documentation of the Command
-interface for mroe details.
+MustStart is like Start but logs the error and exits the process if
+the bot fails to start or stops with an error.
 */
-func (b *Bot) RegisterCommand(c Command) {
-	Log.Debugf("Registering command: %s", c)
-	b.commands = append(b.commands, c)
+func (b *Bot) MustStart(ctx context.Context) {
+	if err := b.Start(ctx); err != nil {
+		b.log.Fatal(err)
+	}
 }
 
-func (b *Bot) runMainLoop() {
-	go b.consumeIncomingMessages()
-
-	for {
-		select {
-		case msg := <-b.messageQueue:
-			go b.handleIncomingMessage(msg)
-		case invocation := <-b.commandQueue:
-			go invocation()
-		case msg := <-b.sendQueue:
-			go b.handleOutgoingMessage(msg)
-		case <-done:
-			Log.Info("Closing gracefully")
-			b.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-			select {
-			case <-time.After(time.Second):
-			}
-			return
-		}
-	}
+/*
+Stop tells a running bot to close its connection to Slack and return from
+Start. It does not wait for the bot to finish; call Wait for that. It is
+safe to call Stop more than once and from any goroutine.
+*/
+func (b *Bot) Stop() {
+	b.stopOnce.Do(func() { close(b.done) })
 }
 
-func getAPITokenOrDie() string {
-	token := os.Getenv(apiTokenEnvKey)
-	if len(token) == 0 {
-		Log.Fatalf("Can't find slack token in env var %s", apiTokenEnvKey)
-	}
-	return token
+/*
+Wait blocks until a started bot has stopped and returns the same error
+that Start returned. It blocks forever if Start is never called.
+*/
+func (b *Bot) Wait() error {
+	<-b.finished
+	return b.err
 }
 
-func (b *Bot) callSlackStartRTM() {
-	Log.Info("Calling Slack RTM start")
+func (b *Bot) run(parent context.Context) error {
+	defer b.cancel()
+	ctx := b.ctx
 
-	postVars := url.Values{}
-	postVars.Set("token", b.apiToken)
-	postVars.Set("simple_latest", "true")
-	postVars.Set("no_unreads", "true")
+	go func() {
+		select {
+		case <-parent.Done():
+			b.Stop()
+		case <-b.done:
+		case <-ctx.Done():
+		}
+		b.cancel()
+	}()
 
-	resp, err := http.PostForm(apiRTMStartEndpoint, postVars)
-	if err != nil {
-		Log.Fatalf("Unable to connect to RTM service: %s", err)
-	}
-	defer resp.Body.Close()
+	b.log.Info("Hello! Starting up...")
 
-	rawBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		Log.Fatalf("Unable to read response body: %s", err)
-	}
+	b.extractHelps()
 
-	parsedBody, err := gabs.ParseJSON(rawBody)
+	self, err := b.transport.Connect(ctx)
 	if err != nil {
-		Log.Fatalf("Unable to parse response body: %s", err)
+		return err
 	}
-
-	if !parsedBody.Path("ok").Data().(bool) {
-		Log.Fatalf("Bad response from RTM start call: %s", parsedBody)
+	if err = b.setIdentity(self); err != nil {
+		b.transport.Close()
+		return err
 	}
 
-	socketURL, err := url.Parse(parsedBody.Path("url").Data().(string))
-	if err != nil {
-		Log.Fatalf("Unable to parse websocket endpoint URI: %s", err)
-	}
-	b.socketURL = socketURL
-	b.teamName = parsedBody.Path("team.name").Data().(string)
-	b.selfName = parsedBody.Path("self.name").Data().(string)
-	b.selfID = parsedBody.Path("self.id").Data().(string)
+	return b.runMainLoop()
+}
 
-	prefixRegStr := `^<@%s>:?\s?`
-	msgPrefix, err = regexp.Compile(fmt.Sprintf(prefixRegStr, b.selfID))
-	if err != nil {
-		Log.Fatalf(`Unable to compile regexp from "%s" for msgPrefix: %s`, prefixRegStr, err)
-	}
+// setIdentity records who the bot is and compiles the addressing patterns that refer to it.
+func (b *Bot) setIdentity(self *Identity) error {
+	b.selfID = self.ID
+	b.selfName = self.Name
+	b.teamName = self.Team
+
+	return b.compileAddressings()
 }
 
-func (b *Bot) startSlackWebsocket() {
-	Log.Infof("Dailing Slack at %s", b.socketURL.String())
-	conn, _, err := websocket.DefaultDialer.Dial(b.socketURL.String(), nil)
-	if err != nil {
-		Log.Fatalf("Unable to open websocket to Slack: %s", err)
-	}
+func (b *Bot) runMainLoop() error {
+	go b.receive()
 
-	b.conn = conn
-	Log.Infof("Connected to %s as %s!", b.teamName, b.selfName)
+	// Once the transport's input ends, poll until the bot is idle and then stop.
+	var idle <-chan time.Time
+
+	for {
+		select {
+		case msg := <-b.messageQueue:
+			atomic.AddInt32(&b.handlingMessages, 1)
+			go func() {
+				defer atomic.AddInt32(&b.handlingMessages, -1)
+				b.handleIncomingMessage(msg)
+			}()
+		case invocation := <-b.commandQueue:
+			b.runCommand(invocation)
+		case msg := <-b.sendQueue:
+			b.send(msg)
+		case err := <-b.transportFailed:
+			if err == io.EOF {
+				b.log.Info("Input ended, stopping once idle")
+				ticker := time.NewTicker(idlePollInterval)
+				defer ticker.Stop()
+				idle = ticker.C
+				continue
+			}
+			b.log.Errorf("Giving up on the connection: %s", err)
+			b.cancelSends()
+			b.transport.Close()
+			return err
+		case <-idle:
+			if b.isIdle() {
+				b.Stop()
+			}
+		case <-b.done:
+			return b.shutdown()
+		}
+	}
 }
 
-func (b *Bot) consumeIncomingMessages() {
-	defer close(done)
+/*
+isIdle reports whether the bot has nothing left to do: no messages waiting
+to be handled, no commands queued or running and no replies queued. It must
+be called from the main loop, which is what moves work between those
+stages.
+*/
+func (b *Bot) isIdle() bool {
+	return len(b.messageQueue) == 0 && atomic.LoadInt32(&b.handlingMessages) == 0 &&
+		len(b.commandQueue) == 0 && atomic.LoadInt32(&b.runningCommands) == 0 &&
+		len(b.sendQueue) == 0
+}
 
+/*
+receive feeds messages from the transport into the message queue until the
+bot stops. If the transport fails for good, or its input ends with io.EOF,
+the error is handed to the main loop.
+*/
+func (b *Bot) receive() {
 	for {
-		msgType, msg, err := b.conn.ReadMessage()
+		msg, err := b.transport.Receive(b.ctx)
 		if err != nil {
-			Log.Errorf("Error reading message: %s", err)
+			if b.ctx.Err() != nil {
+				return
+			}
+			select {
+			case b.transportFailed <- err:
+			case <-b.done:
+			}
 			return
 		}
-		Log.Debugf("Raw incoming message: [%d] %s", msgType, msg)
 
-		if msgType == websocket.TextMessage {
-			parsedMsg, err := gabs.ParseJSON(msg)
-			if err != nil {
-				Log.Errorf("Error parsing message: %s", err)
-				continue
-			}
-			b.messageQueue <- parsedMsg
+		select {
+		case b.messageQueue <- msg:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// runCommand runs a queued command invocation, tracking it for shutdown.
+func (b *Bot) runCommand(invocation func()) {
+	b.inflightCommands.Add(1)
+	atomic.AddInt32(&b.runningCommands, 1)
+	go func() {
+		defer b.inflightCommands.Done()
+		defer atomic.AddInt32(&b.runningCommands, -1)
+		invocation()
+	}()
+}
+
+// send delivers msg through the transport in the background, tracking it for shutdown.
+func (b *Bot) send(msg *SlackMessage) {
+	b.inflightSends.Add(1)
+	atomic.AddInt32(&b.pendingSends, 1)
+	go func() {
+		defer b.inflightSends.Done()
+		defer atomic.AddInt32(&b.pendingSends, -1)
+		if err := b.transport.Send(b.sendCtx, msg); err != nil {
+			b.log.Errorf("Unable to send message: %s", err)
 		}
+	}()
+}
+
+/*
+newSlackTransport builds the Slack transport chosen by cfg: RTM unless
+WithEventsAPI or WithSocketMode was given. All of them need a bot token.
+*/
+func newSlackTransport(api *slackClient, cfg *config) (Transport, error) {
+	if api.token == "" {
+		return nil, &MissingTokenError{apiTokenEnvKey}
 	}
+
+	sc := socketConfig{
+		dialer:          cfg.dialer,
+		pingInterval:    cfg.pingInterval,
+		maxMissedPongs:  cfg.maxMissedPongs,
+		reconnectPolicy: cfg.reconnectPolicy,
+	}
+	switch {
+	case cfg.socketMode:
+		if cfg.appToken == "" {
+			return nil, errors.New("Socket Mode requires an app-level token")
+		}
+		return newSocketModeTransport(api, sc, cfg.appToken), nil
+	case cfg.eventsAPI:
+		if cfg.signingSecret == "" {
+			return nil, errors.New("Events API requires a signing secret")
+		}
+		return newEventsTransport(api, cfg.signingSecret), nil
+	}
+	return newRTMTransport(api, sc), nil
 }
 
-func (b *Bot) handleIncomingMessage(msg *gabs.Container) {
-	if !msg.Exists("type") || !msg.Exists("text") || msg.Path("type").Data().(string) != "message" {
+func (b *Bot) handleIncomingMessage(msg *IncomingMessage) {
+	if msg.Type != "message" || msg.Text == "" {
+		return
+	}
+
+	b.log.Debugf("New message: %s", msg)
+
+	if !b.acceptSender(msg) {
+		b.log.Debugf("Ignoring message from user %q, bot %q", msg.User, msg.BotID)
 		return
 	}
 
-	Log.Debugf("New message: %s", msg)
+	dm := msg.DirectMessage
+	b.dispatchListeners(msg, dm)
 
-	msgText := msg.Path("text").Data().(string)
-	msgChannel := msg.Path("channel").Data().(string)
-	if !msgPrefix.MatchString(msgText) || strings.HasPrefix(msgChannel, "D") {
+	// Messages in channels must be addressed to the bot; in DMs it's optional.
+	msgText, addressed := b.address(msg.Channel, msg.Text)
+	if !addressed && !dm {
 		return
 	}
-	msgText = msgPrefix.ReplaceAllString(msgText, "")
 
 	if helpTrigger.MatchString(msgText) {
-		Log.Debugf("HELP Triggered by %s", msgText)
-		go b.printCommandsHelp(msg.Path("channel").Data().(string), msgText)
+		b.log.Debugf("HELP Triggered by %s", msgText)
+		b.printCommandsHelp(msg, msgText)
 		return
 	}
 
-	for _, cmd := range b.commands {
-		if cmd.Matches(msgText) {
-			Log.Debugf("%s Triggered by %s", cmd, msgText)
-			b.commandQueue <- func() { b.handleCommand(msg, cmd) }
-			return
+	// Handlers see the text with the mention stripped; Raw keeps the original.
+	stripped := *msg
+	stripped.Text = msgText
+	msg = &stripped
+
+	if rt, captures := b.matchRoute(msgText, dm); rt != nil {
+		b.log.Debugf("%s Triggered by %s", rt, msgText)
+		if !b.enqueue(b.ctx, func() { b.serve(rt, msg, captures) }) {
+			b.log.Warningf("Not running %s, shutting down", rt)
 		}
 	}
 }
 
-func (b *Bot) handleCommand(msg *gabs.Container, cmd Command) {
-	channel := msg.Path("channel").Data().(string)
-	text := msgPrefix.ReplaceAllString(msg.Path("text").Data().(string), "")
-
-	Log.Debugf("Running %s", cmd)
-	err := cmd.Run(channel, text, b.sendQueue)
-	if err != nil {
-		Log.Errorf("Error running command: %s", err)
+// matchRoute returns the first route allowed in this scope that matches text.
+func (b *Bot) matchRoute(text string, dm bool) (*Route, []string) {
+	for _, rt := range b.routes {
+		if !rt.scope.allows(dm) {
+			continue
+		}
+		if captures := rt.match(text); captures != nil {
+			return rt, captures
+		}
 	}
+	return nil, nil
 }
 
-func (b *Bot) handleOutgoingMessage(msg *SlackMessage) {
-	str, err := json.Marshal(msg)
-	if err != nil {
-		Log.Errorf("Unable to marshal message: %s", msg)
+// serve runs rt's handler for msg, replying over the bot's send queue.
+func (b *Bot) serve(rt *Route, msg *IncomingMessage, captures []string) {
+	req := b.newRequest(rt, msg, captures)
+	b.serveRequest(rt, &responseWriter{bot: b, req: req}, req)
+}
+
+// newRequest builds the Request passed to rt's handler for msg.
+func (b *Bot) newRequest(rt *Route, msg *IncomingMessage, captures []string) *Request {
+	req := &Request{
+		ctx:      b.ctx,
+		User:     msg.User,
+		Channel:  msg.Channel,
+		TS:       msg.TS,
+		ThreadTS: msg.ThreadTS,
+		Text:     msg.Text,
+		Captures: captures,
+		Params:   make(map[string]string),
+		Message:  msg,
+		Bot:      b,
 	}
+	if rt.pattern != nil {
+		for i, name := range rt.pattern.SubexpNames() {
+			if name != "" && i < len(captures) {
+				req.Params[name] = captures[i]
+			}
+		}
+	}
+	return req
+}
 
-	outgoingSem <- 1
-	Log.Debugf("Sending json: %s", str)
-	b.conn.WriteMessage(websocket.TextMessage, str)
-	<-outgoingSem
+func (b *Bot) serveRequest(rt *Route, w ResponseWriter, req *Request) {
+	b.log.Debugf("Running %s", rt)
+	if err := rt.handler.Handle(w, req); err != nil {
+		b.log.Errorf("Error running command: %s", err)
+	}
 }
@@ -0,0 +1,493 @@
+package gobot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSlack is a minimal local stand-in for the Slack RTM and Web APIs.
+type fakeSlack struct {
+	*httptest.Server
+	rtmStart  map[string]interface{}
+	responses map[string]map[string]interface{}
+	conns     chan *websocket.Conn
+	calls     chan apiCall
+}
+
+// apiCall records a single Web API call made to a fakeSlack.
+type apiCall struct {
+	method string
+	params url.Values
+	body   []byte
+}
+
+func newFakeSlack(t *testing.T) *fakeSlack {
+	f := &fakeSlack{
+		responses: make(map[string]map[string]interface{}),
+		conns:     make(chan *websocket.Conn, 5),
+		calls:     make(chan apiCall, 20),
+	}
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		r.ParseForm()
+		method := strings.TrimPrefix(r.URL.Path, "/api/")
+		f.calls <- apiCall{method, r.PostForm, body}
+
+		resp, ok := f.responses[method]
+		if !ok {
+			resp = map[string]interface{}{"ok": true}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("/api/rtm.start", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(f.rtmStart)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Unable to upgrade websocket: %s", err)
+			return
+		}
+		f.conns <- conn
+	})
+
+	f.Server = httptest.NewServer(mux)
+	f.rtmStart = map[string]interface{}{
+		"ok":   true,
+		"url":  "ws" + strings.TrimPrefix(f.URL, "http") + "/ws",
+		"team": map[string]interface{}{"name": "Test Team"},
+		"self": map[string]interface{}{"id": "U0BOT", "name": "gobot"},
+	}
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeSlack) options() []Option {
+	return []Option{
+		WithToken("xoxb-test"),
+		WithAPIBaseURL(f.URL + "/api"),
+		WithHTTPClient(f.Client()),
+	}
+}
+
+func TestNewBotMissingToken(t *testing.T) {
+	t.Setenv(apiTokenEnvKey, "")
+
+	_, err := NewBot()
+
+	var tokenErr *MissingTokenError
+	if !errors.As(err, &tokenErr) {
+		t.Fatalf("Expected a *MissingTokenError, got %v", err)
+	}
+}
+
+func TestNewBotOptions(t *testing.T) {
+	t.Setenv(apiTokenEnvKey, "xoxb-env")
+
+	b, err := NewBot(WithQueueSizes(1, 2, 3), WithAPIBaseURL("http://localhost:9999/api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.api.token != "xoxb-env" {
+		t.Errorf("Expected token from env, got %q", b.api.token)
+	}
+	if cap(b.sendQueue) != 1 || cap(b.messageQueue) != 2 || cap(b.commandQueue) != 3 {
+		t.Errorf("Queue sizes not applied: %d, %d, %d", cap(b.sendQueue), cap(b.messageQueue), cap(b.commandQueue))
+	}
+	if u := b.api.apiURL("rtm.start"); u != "http://localhost:9999/api/rtm.start" {
+		t.Errorf("Unexpected API URL %s", u)
+	}
+}
+
+func TestConnectToLocalSlack(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self, err := b.transport.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if self.ID != "U0BOT" || self.Team != "Test Team" {
+		t.Errorf("Unexpected rtm.start result: %+v", self)
+	}
+
+	(<-slack.conns).Close()
+	b.transport.Close()
+}
+
+func TestRTMStartSlackError(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.rtmStart = map[string]interface{}{"ok": false, "error": "invalid_auth"}
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.transport.Connect(context.Background())
+
+	var slackErr *SlackError
+	if !errors.As(err, &slackErr) || slackErr.Message != "invalid_auth" {
+		t.Fatalf("Expected an invalid_auth *SlackError, got %v", err)
+	}
+}
+
+// recordCommand matches a single exact text and records the channels it ran in.
+type recordCommand struct {
+	trigger string
+	ran     chan string
+}
+
+func (r recordCommand) Help() string             { return "*" + r.trigger + "*: Records invocations." }
+func (r recordCommand) Matches(text string) bool { return text == r.trigger }
+func (r recordCommand) Run(channel string, text string, out chan *SlackMessage) error {
+	r.ran <- channel
+	return nil
+}
+
+func newIdentifiedBot(t *testing.T, selfID string) *Bot {
+	b, err := NewBot(WithToken("xoxb-" + selfID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.setIdentity(&Identity{ID: selfID, Name: selfID}); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// dispatch feeds a raw event to b and runs any invocations it queues.
+func dispatch(t *testing.T, b *Bot, raw string) {
+	msg, err := ParseIncomingMessage([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatchMessage(b, msg)
+}
+
+// dispatchMessage feeds msg to b and runs any invocations it queues.
+func dispatchMessage(b *Bot, msg *IncomingMessage) {
+	b.handleIncomingMessage(msg)
+
+	for {
+		select {
+		case invocation := <-b.commandQueue:
+			invocation()
+		default:
+			return
+		}
+	}
+}
+
+func TestBotsRouteIndependently(t *testing.T) {
+	first := newIdentifiedBot(t, "U0FIRST")
+	second := newIdentifiedBot(t, "U0SECOND")
+
+	firstRan := make(chan string, 5)
+	secondRan := make(chan string, 5)
+	first.RegisterCommand(recordCommand{"ping", firstRan})
+	second.RegisterCommand(recordCommand{"ping", secondRan})
+
+	for _, b := range []*Bot{first, second} {
+		dispatch(t, b, `{"type": "message", "channel": "C1", "text": "<@U0FIRST>: ping"}`)
+		dispatch(t, b, `{"type": "message", "channel": "C2", "text": "<@U0SECOND>: ping"}`)
+	}
+
+	if len(firstRan) != 1 || <-firstRan != "C1" {
+		t.Errorf("Expected first bot to run only for its own mention")
+	}
+	if len(secondRan) != 1 || <-secondRan != "C2" {
+		t.Errorf("Expected second bot to run only for its own mention")
+	}
+}
+
+func TestBotsCountMessageIDsIndependently(t *testing.T) {
+	first := newIdentifiedBot(t, "U0FIRST").transport.(*rtmTransport)
+	second := newIdentifiedBot(t, "U0SECOND").transport.(*rtmTransport)
+
+	first.nextMessageID()
+	first.nextMessageID()
+
+	if id := second.nextMessageID(); id != 1 {
+		t.Errorf("Expected second bot's first message ID to be 1, got %d", id)
+	}
+	if id := first.nextMessageID(); id != 3 {
+		t.Errorf("Expected first bot's third message ID to be 3, got %d", id)
+	}
+}
+
+func TestBotsStopIndependently(t *testing.T) {
+	first := newIdentifiedBot(t, "U0FIRST")
+	second := newIdentifiedBot(t, "U0SECOND")
+
+	first.Stop()
+	first.Stop()
+
+	select {
+	case <-second.done:
+		t.Fatal("Stopping one bot stopped the other")
+	default:
+	}
+}
+
+// contextCommand blocks until its context is cancelled and reports the cause.
+type contextCommand struct {
+	started chan struct{}
+	stopped chan error
+}
+
+func (c contextCommand) Help() string             { return "*wait*: Waits for shutdown." }
+func (c contextCommand) Matches(text string) bool { return text == "wait" }
+func (c contextCommand) Run(channel string, text string, out chan *SlackMessage) error {
+	return errors.New("Run called instead of RunContext")
+}
+func (c contextCommand) RunContext(ctx context.Context, msg *IncomingMessage, out chan *SlackMessage) error {
+	close(c.started)
+	<-ctx.Done()
+	c.stopped <- ctx.Err()
+	return nil
+}
+
+func TestStartReturnsWhenContextCancelled(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := contextCommand{make(chan struct{}), make(chan error, 1)}
+	b.RegisterCommand(cmd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error, 1)
+	go func() { started <- b.Start(ctx) }()
+
+	server := <-slack.conns
+	defer server.Close()
+	server.WriteMessage(websocket.TextMessage, []byte(`{"type": "message", "channel": "C1", "text": "<@U0BOT> wait"}`))
+	<-cmd.started
+
+	cancel()
+
+	if err = <-started; err != nil {
+		t.Errorf("Expected graceful shutdown, got %s", err)
+	}
+	if err = b.Wait(); err != nil {
+		t.Errorf("Expected Wait to return nil, got %s", err)
+	}
+	if err = <-cmd.stopped; err != context.Canceled {
+		t.Errorf("Expected command context to be cancelled, got %v", err)
+	}
+}
+
+func TestRequestContextAvailableBeforeStart(t *testing.T) {
+	b, err := NewBot(WithTransport(NewMemoryTransport(Identity{ID: "U0BOT"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := &Route{name: "test"}
+
+	// HTTP handlers such as slash commands may build requests while Start is running.
+	built := make(chan *Request)
+	go func() { built <- b.newRequest(rt, &IncomingMessage{}, nil) }()
+	go b.Start(context.Background())
+
+	req := <-built
+	if req.Context().Err() != nil {
+		t.Fatal("Expected the request context to be live while the bot runs")
+	}
+	b.Stop()
+	b.Wait()
+	if req.Context().Err() != context.Canceled {
+		t.Errorf("Expected the request context to be cancelled on shutdown, got %v", req.Context().Err())
+	}
+}
+
+func TestStopEndsStart(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go b.Start(context.Background())
+	server := <-slack.conns
+	defer server.Close()
+
+	b.Stop()
+
+	if err = b.Wait(); err != nil {
+		t.Errorf("Expected graceful shutdown, got %s", err)
+	}
+	if err = b.Start(context.Background()); err == nil {
+		t.Error("Expected restarting a stopped bot to fail")
+	}
+}
+
+func TestNothingQueuedAfterStop(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	b.RegisterCommand(recordCommand{"ping", make(chan string, 1)})
+	b.Stop()
+
+	// The queue has room, so some of these would be queued if Stop weren't checked first.
+	for i := 0; i < 20; i++ {
+		b.handleIncomingMessage(&IncomingMessage{Type: "message", Channel: "C1", Text: "<@U0BOT> ping"})
+	}
+	if n := len(b.commandQueue); n != 0 {
+		t.Errorf("Expected nothing queued after Stop, got %d commands", n)
+	}
+}
+
+// replyOnStopCommand replies once its context is cancelled, then optionally hangs.
+type replyOnStopCommand struct {
+	started chan struct{}
+	hang    bool
+}
+
+func (c replyOnStopCommand) Help() string             { return "*slow*: Replies on shutdown." }
+func (c replyOnStopCommand) Matches(text string) bool { return text == "slow" }
+func (c replyOnStopCommand) Run(channel string, text string, out chan *SlackMessage) error {
+	return errors.New("Run called instead of RunContext")
+}
+func (c replyOnStopCommand) RunContext(ctx context.Context, msg *IncomingMessage, out chan *SlackMessage) error {
+	close(c.started)
+	<-ctx.Done()
+	out <- NewSlackMessage(msg.Channel, "finished")
+	if c.hang {
+		select {}
+	}
+	return nil
+}
+
+func startWithCommand(t *testing.T, cmd Command, opts ...Option) (*Bot, *websocket.Conn) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(append(slack.options(), opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterCommand(cmd)
+
+	go b.Start(context.Background())
+	server := <-slack.conns
+	t.Cleanup(func() { server.Close() })
+
+	return b, server
+}
+
+func TestShutdownDrainsCommandsAndMessages(t *testing.T) {
+	cmd := replyOnStopCommand{started: make(chan struct{})}
+	b, server := startWithCommand(t, cmd)
+
+	server.WriteMessage(websocket.TextMessage, []byte(`{"type": "message", "channel": "C1", "text": "<@U0BOT> slow"}`))
+	<-cmd.started
+	b.Stop()
+
+	_, reply, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(reply), `"finished"`) {
+		t.Errorf("Expected the command's reply before closing, got %s", reply)
+	}
+	if _, _, err = server.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected a normal close frame after the reply, got %v", err)
+	}
+
+	if err = b.Wait(); err != nil {
+		t.Errorf("Expected a clean shutdown, got %s", err)
+	}
+}
+
+func TestShutdownReportsAbandonedCommands(t *testing.T) {
+	cmd := replyOnStopCommand{started: make(chan struct{}), hang: true}
+	b, server := startWithCommand(t, cmd, WithShutdownTimeout(50*time.Millisecond))
+
+	server.WriteMessage(websocket.TextMessage, []byte(`{"type": "message", "channel": "C1", "text": "<@U0BOT> slow"}`))
+	<-cmd.started
+	b.Stop()
+
+	var shutdownErr *ShutdownError
+	if err := b.Wait(); !errors.As(err, &shutdownErr) || shutdownErr.AbandonedCommands != 1 {
+		t.Fatalf("Expected one abandoned command, got %v", err)
+	}
+}
+
+func TestReplyHeldAcrossReconnect(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(append(slack.options(), WithReconnectPolicy(ReconnectPolicy{MinBackoff: 50 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.Start(context.Background())
+	defer b.Stop()
+	first := <-slack.conns
+	defer first.Close()
+
+	// Break the bot's end of the socket so that writing the reply fails.
+	rtm := b.transport.(*rtmTransport)
+	_, connected := rtm.current()
+	<-connected
+	conn, _ := rtm.current()
+	conn.UnderlyingConn().Close()
+	b.sendQueue <- NewSlackMessage("C1", "still here")
+
+	second := <-slack.conns
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, reply, err := second.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(reply), `"still here"`) {
+		t.Errorf("Expected the held reply on the new socket, got %s", reply)
+	}
+}
+
+func TestStartFailsWhenReconnectGivesUp(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(append(slack.options(), WithReconnectPolicy(ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxAttempts: 2}))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan error, 1)
+	go func() { started <- b.Start(context.Background()) }()
+	first := <-slack.conns
+
+	slack.Close()
+	first.Close()
+
+	select {
+	case err = <-started:
+		if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+			t.Errorf("Expected Start to give up after 2 attempts, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start didn't return after reconnecting failed")
+	}
+}
@@ -5,29 +5,29 @@ import (
 	"os/signal"
 )
 
-var (
-	interrupt = make(chan os.Signal)
-)
-
-func init() {
-	signal.Notify(interrupt, os.Interrupt)
-}
-
 /*
 StartCLI launches a goroutine to handle the CLI envorinment.
 
 Packages implementing Gobot as a compiled binary launched via a CLI should
-call this method before Bot.Start() to properly handle interrupts and
-stdin/out redirection.
+call this method before Bot.Start() to properly handle interrupts. Each bot
+handles interrupts independently, so several bots in one process can all
+call StartCLI. To talk to the bot from the terminal instead of Slack, give
+it a ConsoleTransport.
 */
-func StartCLI() {
-	go handleInterrupt()
+func (b *Bot) StartCLI() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go b.handleInterrupt(interrupt)
 }
 
-func handleInterrupt() {
+func (b *Bot) handleInterrupt(interrupt chan os.Signal) {
+	defer signal.Stop(interrupt)
+
 	select {
 	case sig := <-interrupt:
-		Log.Info("Interrupt: %s", sig)
-		close(done)
+		b.log.Infof("Interrupt: %s", sig)
+		b.Stop()
+	case <-b.done:
 	}
 }
@@ -46,7 +46,10 @@ func (a AddCommand) Run(channel string, text string, out chan *gobot.SlackMessag
 }
 
 func ExampleCommand() {
-	b := gobot.NewBot()
+	b, err := gobot.NewBot()
+	if err != nil {
+		gobot.Log.Fatal(err)
+	}
 	matcher := regexp.MustCompile(`add (?{<a>\d+) (?P<b>\d+)`)
 	b.RegisterCommand(AddCommand{matcher})
 }
@@ -1,5 +1,9 @@
 package gobot
 
+import (
+	"context"
+)
+
 /*
 Command provides an interface for a bot command.
 
@@ -25,9 +29,26 @@ to send any outgoing messages to.
 
 Although not required to satisfy this interface, implementing Commands should also
 define a String function to implement the Stringer interface for better logging.
+
+Commands that need to know who invoked them, reply in threads, or react to
+messages should implement Handler instead.
 */
 type Command interface {
 	Help() string
 	Matches(text string) bool
 	Run(channel string, text string, out chan *SlackMessage) error
 }
+
+/*
+ContextCommand is a Command that wants the full triggering message and to
+know when the bot is shutting down. If a registered Command implements
+ContextCommand, the bot calls RunContext instead of Run.
+
+ctx is cancelled when the bot is stopped; long-running commands should watch
+ctx.Done() and return early. msg is the triggering message with the bot
+mention stripped from its Text; the original payload is still in msg.Raw.
+*/
+type ContextCommand interface {
+	Command
+	RunContext(ctx context.Context, msg *IncomingMessage, out chan *SlackMessage) error
+}
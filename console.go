@@ -0,0 +1,198 @@
+package gobot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const consoleUsage = `Console commands:
+  /user <id>       talk as another user
+  /channel <id>    talk in another channel; IDs starting with D are direct messages
+  /quit            stop the bot
+Anything else is sent to the bot as a message.`
+
+/*
+ConsoleTransport is a Transport that reads messages typed at a terminal (or
+piped in) and prints the bot's replies, for developing commands locally and
+running them in CI without a Slack token or network access.
+
+Each line read from the input is sent to the bot as a message from User in
+Channel. By default that's a direct message, so commands don't need to be
+addressed to the bot; switch to a channel with "/channel C1" to try out
+addressing. "/user" changes who's talking, and "/quit" or the end of the
+input stops the bot once it has finished replying.
+
+	bot, _ := gobot.NewBot(gobot.WithTransport(gobot.NewConsoleTransport(os.Stdin, os.Stdout)))
+
+Fields must be set before the bot is started.
+*/
+type ConsoleTransport struct {
+	// Self is who the bot is; it defaults to "gobot" with the ID U0BOT.
+	Self Identity
+	// User is the ID messages are sent as; it defaults to U0DEV.
+	User string
+	// Channel is the ID messages are sent in; it defaults to D0CONSOLE.
+	Channel string
+	// Prompt, if set, is printed before each line of input. It defaults to "> ".
+	Prompt string
+
+	in     io.Reader
+	out    io.Writer
+	outMu  sync.Mutex
+	lineNo int
+
+	incoming  chan *IncomingMessage
+	ended     chan struct{}
+	err       error
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewConsoleTransport returns a ConsoleTransport that reads from in and writes to out.
+func NewConsoleTransport(in io.Reader, out io.Writer) *ConsoleTransport {
+	return &ConsoleTransport{
+		Self:     Identity{ID: "U0BOT", Name: "gobot", Team: "console"},
+		User:     "U0DEV",
+		Channel:  "D0CONSOLE",
+		Prompt:   "> ",
+		in:       in,
+		out:      out,
+		incoming: make(chan *IncomingMessage),
+		ended:    make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Connect implements Transport. It starts reading input.
+func (t *ConsoleTransport) Connect(ctx context.Context) (*Identity, error) {
+	t.printf("Talking to %s as %s in %s. Type /help for console commands.\n", t.Self.Name, t.User, t.Channel)
+	go t.read()
+
+	self := t.Self
+	return &self, nil
+}
+
+func (t *ConsoleTransport) read() {
+	defer close(t.ended)
+
+	scanner := bufio.NewScanner(t.in)
+	for {
+		t.prompt()
+		if !scanner.Scan() {
+			t.err = scanner.Err()
+			if t.err == nil {
+				t.err = io.EOF
+			}
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "/") {
+			if quit := t.command(line); quit {
+				t.err = io.EOF
+				return
+			}
+			continue
+		}
+
+		t.lineNo++
+		msg := &IncomingMessage{
+			Type:          "message",
+			Channel:       t.Channel,
+			User:          t.User,
+			Text:          line,
+			TS:            fmt.Sprintf("%d.%06d", time.Now().Unix(), t.lineNo),
+			DirectMessage: isDirectMessage(t.Channel),
+		}
+		select {
+		case t.incoming <- msg:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// command runs a console command, reporting whether it was /quit.
+func (t *ConsoleTransport) command(line string) bool {
+	fields := strings.Fields(line)
+	switch {
+	case fields[0] == "/quit":
+		return true
+	case fields[0] == "/user" && len(fields) == 2:
+		t.User = fields[1]
+		t.printf("Now talking as %s\n", t.User)
+	case fields[0] == "/channel" && len(fields) == 2:
+		t.Channel = fields[1]
+		t.printf("Now talking in %s\n", t.Channel)
+	default:
+		t.printf("%s\n", consoleUsage)
+	}
+	return false
+}
+
+func (t *ConsoleTransport) prompt() {
+	if t.Prompt != "" {
+		t.printf("%s", t.Prompt)
+	}
+}
+
+func (t *ConsoleTransport) printf(format string, args ...interface{}) {
+	t.outMu.Lock()
+	defer t.outMu.Unlock()
+	fmt.Fprintf(t.out, format, args...)
+}
+
+/*
+Receive implements Transport. It returns io.EOF once the input ends or
+/quit is typed.
+*/
+func (t *ConsoleTransport) Receive(ctx context.Context) (*IncomingMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.ended:
+		return nil, t.err
+	case <-t.closed:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Send implements Transport by printing msg.
+func (t *ConsoleTransport) Send(ctx context.Context, msg *SlackMessage) error {
+	where := msg.Channel
+	if msg.ThreadTS != "" {
+		where += " thread " + msg.ThreadTS
+	}
+	t.printf("[%s] %s: %s\n", where, t.Self.Name, msg.Text)
+	if len(msg.Attachments) > 0 || msg.Blocks != nil {
+		t.printf("[%s] (%d attachments and any blocks not shown)\n", where, len(msg.Attachments))
+	}
+	return nil
+}
+
+// React implements Reactor by printing the reaction.
+func (t *ConsoleTransport) React(ctx context.Context, channel, ts, emoji string) error {
+	t.printf("[%s] %s reacted with :%s: to %s\n", channel, t.Self.Name, strings.Trim(emoji, ":"), ts)
+	return nil
+}
+
+// OpenDM implements DirectMessenger. Direct message channels are named "D" followed by the user's ID.
+func (t *ConsoleTransport) OpenDM(ctx context.Context, user string) (string, error) {
+	return "D" + user, nil
+}
+
+// Close implements Transport.
+func (t *ConsoleTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
@@ -0,0 +1,75 @@
+package gobot
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConsoleTransport(t *testing.T) {
+	t.Setenv(apiTokenEnvKey, "")
+
+	script := strings.Join([]string{
+		"ping",
+		"/channel C1",
+		"ping",
+		"<@U0BOT> ping",
+		"/user U2",
+		"<@U0BOT> ping",
+		"/bogus",
+		"",
+	}, "\n")
+	var out bytes.Buffer
+	console := NewConsoleTransport(strings.NewReader(script), &out)
+	console.Prompt = ""
+
+	b, err := NewBot(WithTransport(console))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^ping$`), "*ping*: Replies pong.", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		if err := w.React("thumbsup"); err != nil {
+			return err
+		}
+		return w.Reply("pong " + r.User)
+	}))
+
+	if err = b.Start(context.Background()); err != nil {
+		t.Fatalf("Expected the bot to stop cleanly at the end of input, got %s", err)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"[D0CONSOLE] gobot: pong U0DEV\n",
+		"[C1] gobot: pong U0DEV\n",
+		"[C1] gobot: pong U2\n",
+		"[C1] gobot reacted with :thumbsup: to ",
+		"Now talking as U2\n",
+		"/quit            stop the bot",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "gobot: pong"); n != 3 {
+		t.Errorf("Expected 3 replies with the unaddressed channel message ignored, got %d:\n%s", n, got)
+	}
+}
+
+func TestConsoleTransportQuit(t *testing.T) {
+	var out bytes.Buffer
+	console := NewConsoleTransport(strings.NewReader("/quit\nping\n"), &out)
+
+	b, err := NewBot(WithTransport(console))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "Talking to gobot as U0DEV in D0CONSOLE.") || !strings.HasSuffix(out.String(), "> ") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+}
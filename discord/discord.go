@@ -0,0 +1,449 @@
+/*
+Package discord connects gobot to Discord as a bot user, so the same
+commands and handlers can serve Discord servers as well as Slack:
+
+	transport, err := discord.New(discord.Config{Token: os.Getenv("DISCORD_TOKEN")})
+	if err != nil {
+		log.Fatal(err)
+	}
+	bot, err := gobot.NewBot(gobot.WithTransport(transport))
+
+Events are received over the Discord gateway and replies are created with
+the REST API. The transport identifies with DefaultIntents, which include
+the privileged message content intent; enable it for the application in the
+Discord developer portal. Dropped gateway connections are resumed, so no
+messages are missed.
+
+Users and channels are identified by their Discord IDs, and Discord's
+<@id> mention syntax is the one gobot already uses, so the default
+MentionPrefix addressing works unchanged. Messages sent outside a guild
+are received as direct messages.
+*/
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/jlindsey/gobot"
+	"github.com/op/go-logging"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Gateway intents the transport can subscribe to.
+const (
+	IntentGuilds         = 1 << 0
+	IntentGuildMessages  = 1 << 9
+	IntentDirectMessages = 1 << 12
+	IntentMessageContent = 1 << 15
+
+	// DefaultIntents receive messages in servers and direct messages, with their content.
+	DefaultIntents = IntentGuilds | IntentGuildMessages | IntentDirectMessages | IntentMessageContent
+)
+
+const (
+	defaultAPIURL      = "https://discord.com/api/v10"
+	defaultGatewayURL  = "wss://gateway.discord.gg"
+	defaultHTTPTimeout = 30 * time.Second
+	userAgent          = "DiscordBot (https://github.com/jlindsey/gobot, 1.0)"
+
+	// maxContent is the longest message content Discord accepts, in characters.
+	maxContent = 2000
+)
+
+// nicknameMention matches the <@!id> form Discord uses for mentions of users with a server nickname.
+var nicknameMention = regexp.MustCompile(`<@!(\d+)>`)
+
+// Config describes the bot to connect as. Token is required.
+type Config struct {
+	// Token is the bot token from the Discord developer portal.
+	Token string
+	// Intents are the gateway intents to identify with. They default to DefaultIntents.
+	Intents int
+	// Reconnect controls how dropped gateway connections are retried. Zero fields take the defaults.
+	Reconnect gobot.ReconnectPolicy
+
+	// APIURL and GatewayURL override Discord's REST and gateway endpoints, eg. for testing.
+	APIURL     string
+	GatewayURL string
+	// HTTPClient makes REST API calls. It defaults to a client with a 30 second timeout.
+	HTTPClient *http.Client
+
+	// Logger receives gateway and REST API logs, such as resumed sessions and rate limiting. It defaults to gobot.Log.
+	Logger *logging.Logger
+}
+
+// user is the part of a Discord user object the transport needs.
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+// discordMessage is the part of a Discord message object the transport needs.
+type discordMessage struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+	Author    user   `json:"author"`
+	Content   string `json:"content"`
+}
+
+// incoming converts m into the message the bot receives.
+func (m *discordMessage) incoming() *gobot.IncomingMessage {
+	msg := &gobot.IncomingMessage{
+		Type:          "message",
+		Channel:       m.ChannelID,
+		User:          m.Author.ID,
+		Text:          nicknameMention.ReplaceAllString(m.Content, "<@$1>"),
+		TS:            m.ID,
+		DirectMessage: m.GuildID == "",
+	}
+	if m.Author.Bot {
+		msg.BotID = m.Author.ID
+	}
+	return msg
+}
+
+/*
+Transport is a gobot.Transport for Discord. It also implements
+gobot.DirectMessenger.
+*/
+type Transport struct {
+	// seq is the sequence number of the last dispatch received. It's first for atomic alignment.
+	seq int64
+
+	cfg    Config
+	log    *logging.Logger
+	dialer *websocket.Dialer
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	sessionID string
+	resumeURL string
+	writeMu   sync.Mutex
+
+	incoming  chan *gobot.IncomingMessage
+	stopped   chan struct{}
+	err       error
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New returns a Transport that identifies with cfg.Token once Connect opens the gateway.
+func New(cfg Config) (*Transport, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("Discord bot token is required")
+	}
+	if cfg.Intents == 0 {
+		cfg.Intents = DefaultIntents
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = defaultAPIURL
+	}
+	if cfg.GatewayURL == "" {
+		cfg.GatewayURL = defaultGatewayURL
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultHTTPTimeout}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = gobot.Log
+	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+	cfg.GatewayURL = strings.TrimRight(cfg.GatewayURL, "/")
+
+	return &Transport{
+		cfg:      cfg,
+		log:      cfg.Logger,
+		dialer:   &websocket.Dialer{Proxy: http.ProxyFromEnvironment, HandshakeTimeout: defaultHTTPTimeout},
+		incoming: make(chan *gobot.IncomingMessage),
+		stopped:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+/*
+Connect implements gobot.Transport. It opens the gateway and identifies,
+returning once Discord says the session is ready.
+*/
+func (t *Transport) Connect(ctx context.Context) (*gobot.Identity, error) {
+	conn, interval, err := t.dial(t.cfg.GatewayURL)
+	if err != nil {
+		return nil, err
+	}
+	if err = t.identify(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	ready, err := t.awaitReady(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	t.setSession(*ready)
+	t.setConn(conn)
+	t.log.Infof("Connected to Discord as %s", ready.User.Username)
+
+	go t.run(conn, interval)
+	return &gobot.Identity{ID: ready.User.ID, Name: ready.User.Username, Team: "discord"}, nil
+}
+
+// awaitReady reads from conn until the READY dispatch arrives.
+func (t *Transport) awaitReady(ctx context.Context, conn *websocket.Conn) (*readyEvent, error) {
+	deadline := time.Now().Add(helloTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	for {
+		var p payload
+		if err := conn.ReadJSON(&p); err != nil {
+			return nil, t.closeError(err)
+		}
+
+		switch {
+		case p.Op == opDispatch && p.T == "READY":
+			var ready readyEvent
+			if err := json.Unmarshal(p.D, &ready); err != nil {
+				return nil, err
+			}
+			atomic.StoreInt64(&t.seq, p.S)
+			return &ready, nil
+		case p.Op == opHeartbeat:
+			if err := t.heartbeat(conn); err != nil {
+				return nil, err
+			}
+		case p.Op == opInvalidSession:
+			return nil, errors.New("Discord rejected the identify")
+		}
+	}
+}
+
+/*
+run serves the gateway connection, resuming the session on a new one
+whenever it drops, until the transport is closed or the failure can't be
+recovered from.
+*/
+func (t *Transport) run(conn *websocket.Conn, interval time.Duration) {
+	defer close(t.stopped)
+
+	for {
+		err := t.serve(conn, interval)
+		conn.Close()
+
+		select {
+		case <-t.closed:
+			t.err = gobot.ErrTransportClosed
+			return
+		default:
+		}
+		if _, fatal := err.(*fatalError); fatal {
+			t.err = err
+			return
+		}
+		t.log.Warningf("Lost Discord gateway connection: %s", err)
+
+		if conn, interval, err = t.reconnect(); err != nil {
+			t.err = err
+			return
+		}
+	}
+}
+
+/*
+reconnect opens a new gateway connection, resuming the session if it can
+and identifying afresh if not, retrying as the reconnect policy allows.
+*/
+func (t *Transport) reconnect() (*websocket.Conn, time.Duration, error) {
+	var conn *websocket.Conn
+	var interval time.Duration
+	var fatal error
+	err := t.cfg.Reconnect.Retry(t.closed, t.log, func(int) error {
+		c, i, err := t.redial()
+		if _, ok := err.(*fatalError); ok {
+			// Retrying can't help, so stop here and report it below.
+			fatal = err
+			return nil
+		}
+		conn, interval = c, i
+		return err
+	})
+	if err == nil {
+		err = fatal
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !t.setConn(conn) {
+		conn.Close()
+		return nil, 0, gobot.ErrTransportClosed
+	}
+	return conn, interval, nil
+}
+
+// redial makes a single attempt at a new gateway connection for reconnect.
+func (t *Transport) redial() (*websocket.Conn, time.Duration, error) {
+	sessionID, gatewayURL := t.session()
+	if sessionID == "" {
+		gatewayURL = t.cfg.GatewayURL
+	}
+	conn, interval, err := t.dial(gatewayURL)
+	if err == nil {
+		if sessionID != "" {
+			err = t.resume(conn, sessionID)
+		} else {
+			err = t.identify(conn)
+		}
+	}
+	if err != nil {
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, 0, err
+	}
+	return conn, interval, nil
+}
+
+// setConn makes conn the connection Close shuts down. It reports false if the transport has been closed.
+func (t *Transport) setConn(conn *websocket.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case <-t.closed:
+		return false
+	default:
+	}
+	t.conn = conn
+	return true
+}
+
+func (t *Transport) setSession(ready readyEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sessionID = ready.SessionID
+	t.resumeURL = strings.TrimRight(ready.ResumeGatewayURL, "/")
+	if t.resumeURL == "" {
+		t.resumeURL = t.cfg.GatewayURL
+	}
+}
+
+// session returns the session to resume and the gateway to resume it on, or "" if it can't be resumed.
+func (t *Transport) session() (string, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID, t.resumeURL
+}
+
+// forgetSession makes the next connection identify afresh instead of resuming.
+func (t *Transport) forgetSession() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sessionID = ""
+	atomic.StoreInt64(&t.seq, 0)
+}
+
+// Receive implements gobot.Transport.
+func (t *Transport) Receive(ctx context.Context) (*gobot.IncomingMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.stopped:
+		return nil, t.err
+	case <-t.closed:
+		return nil, gobot.ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+Send implements gobot.Transport by creating a message in msg's channel.
+Text longer than Discord allows is split over several messages. A message
+with a ThreadTS is sent as a reply to that message. Blocks and attachments
+are ignored.
+*/
+func (t *Transport) Send(ctx context.Context, msg *gobot.SlackMessage) error {
+	path := "/channels/" + msg.Channel + "/messages"
+
+	for i, content := range splitContent(msg.Text) {
+		body := map[string]interface{}{"content": content}
+		if msg.ThreadTS != "" && i == 0 {
+			body["message_reference"] = map[string]interface{}{"message_id": msg.ThreadTS, "fail_if_not_exists": false}
+		}
+		if err := t.call(ctx, "POST", path, body, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitContent breaks text into pieces no longer than Discord allows, preferring to break at newlines, then spaces.
+func splitContent(text string) []string {
+	var pieces []string
+	for utf8.RuneCountInString(text) > maxContent {
+		cut := 0
+		for n := 0; n < maxContent; n++ {
+			_, size := utf8.DecodeRuneInString(text[cut:])
+			cut += size
+		}
+		if i := strings.LastIndexByte(text[:cut], '\n'); i > 0 {
+			cut = i
+		} else if i := strings.LastIndexByte(text[:cut], ' '); i > 0 {
+			cut = i
+		}
+		pieces = append(pieces, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n ")
+	}
+	if text != "" {
+		pieces = append(pieces, text)
+	}
+	return pieces
+}
+
+// OpenDM implements gobot.DirectMessenger by creating (or finding) the direct message channel with user.
+func (t *Transport) OpenDM(ctx context.Context, userID string) (string, error) {
+	var channel struct {
+		ID string `json:"id"`
+	}
+	if err := t.call(ctx, "POST", "/users/@me/channels", map[string]string{"recipient_id": userID}, &channel); err != nil {
+		return "", err
+	}
+	return channel.ID, nil
+}
+
+/*
+Close implements gobot.Transport by closing the gateway connection, which
+also ends the session.
+*/
+func (t *Transport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		close(t.closed)
+		conn := t.conn
+		t.mu.Unlock()
+		if conn == nil {
+			return
+		}
+
+		t.writeMu.Lock()
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		t.writeMu.Unlock()
+		err = conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,400 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/jlindsey/gobot"
+	"github.com/jlindsey/gobot/transporttest"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gatewayConn is a client connection accepted by the fake gateway.
+type gatewayConn struct {
+	*websocket.Conn
+	path string
+}
+
+// fakeDiscord serves a fake gateway on /gateway and /resume and enough of the REST API for the transport.
+type fakeDiscord struct {
+	*httptest.Server
+	t                 *testing.T
+	heartbeatInterval int
+	conns             chan gatewayConn
+	messages          chan string
+	rateLimited       int32
+}
+
+func newFakeDiscord(t *testing.T, heartbeatInterval int) *fakeDiscord {
+	d := &fakeDiscord{t: t, heartbeatInterval: heartbeatInterval, conns: make(chan gatewayConn, 2), messages: make(chan string, 10)}
+
+	gateway := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") != "10" || r.URL.Query().Get("encoding") != "json" {
+			t.Errorf("Unexpected gateway query %s", r.URL.RawQuery)
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.WriteJSON(map[string]interface{}{"op": opHello, "d": map[string]int{"heartbeat_interval": d.heartbeatInterval}})
+		d.conns <- gatewayConn{conn, r.URL.Path}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gateway", gateway)
+	mux.HandleFunc("/resume", gateway)
+	mux.HandleFunc("/api/channels/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message": "401: Unauthorized", "code": 0}`)
+			return
+		}
+		if atomic.AddInt32(&d.rateLimited, -1) >= 0 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"message": "You are being rate limited.", "retry_after": 0.01, "global": false}`)
+			return
+		}
+
+		var body struct {
+			Content          string `json:"content"`
+			MessageReference struct {
+				MessageID string `json:"message_id"`
+			} `json:"message_reference"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		channel := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/channels/"), "/messages")
+		if body.MessageReference.MessageID != "" {
+			channel += " reply to " + body.MessageReference.MessageID
+		}
+		d.messages <- channel + ": " + body.Content
+		fmt.Fprint(w, `{"id": "999"}`)
+	})
+	mux.HandleFunc("/api/users/@me/channels", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprintf(w, `{"id": "dm-%s"}`, body["recipient_id"])
+	})
+
+	d.Server = httptest.NewServer(mux)
+	t.Cleanup(d.Close)
+	return d
+}
+
+func (d *fakeDiscord) wsURL(path string) string {
+	return "ws" + strings.TrimPrefix(d.URL, "http") + path
+}
+
+func (d *fakeDiscord) newTransport() *Transport {
+	transport, err := New(Config{
+		Token:      "token",
+		APIURL:     d.URL + "/api",
+		GatewayURL: d.wsURL("/gateway"),
+		Reconnect:  gobot.ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	return transport
+}
+
+func (d *fakeDiscord) accept() gatewayConn {
+	d.t.Helper()
+	select {
+	case conn := <-d.conns:
+		d.t.Cleanup(func() { conn.Close() })
+		return conn
+	case <-time.After(5 * time.Second):
+		d.t.Fatal("Timed out waiting for a gateway connection")
+		return gatewayConn{}
+	}
+}
+
+func (d *fakeDiscord) nextMessage() string {
+	d.t.Helper()
+	select {
+	case msg := <-d.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		d.t.Fatal("Timed out waiting for a message")
+		return ""
+	}
+}
+
+// expect reads commands from the client until one with the given opcode arrives, and returns its data.
+func (c gatewayConn) expect(t *testing.T, op int) map[string]interface{} {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var cmd struct {
+			Op int             `json:"op"`
+			D  json.RawMessage `json:"d"`
+		}
+		if err := c.ReadJSON(&cmd); err != nil {
+			t.Fatalf("Waiting for opcode %d: %s", op, err)
+		}
+		if cmd.Op == op {
+			var data map[string]interface{}
+			json.Unmarshal(cmd.D, &data)
+			if data == nil {
+				data = map[string]interface{}{"d": json.RawMessage(cmd.D)}
+			}
+			return data
+		}
+	}
+}
+
+func (c gatewayConn) dispatch(seq int, event string, data interface{}) {
+	c.WriteJSON(map[string]interface{}{"op": opDispatch, "s": seq, "t": event, "d": data})
+}
+
+func (c gatewayConn) ready(d *fakeDiscord) {
+	c.dispatch(1, "READY", map[string]interface{}{
+		"user":               map[string]string{"id": "100", "username": "gobot"},
+		"session_id":         "session",
+		"resume_gateway_url": d.wsURL("/resume"),
+	})
+}
+
+func message(id, guild, channel, author, content string) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "guild_id": guild, "channel_id": channel, "content": content,
+		"author": map[string]string{"id": author, "username": "user" + author},
+	}
+}
+
+func TestBotOverDiscord(t *testing.T) {
+	d := newFakeDiscord(t, 45000)
+	transport := d.newTransport()
+
+	b, err := gobot.NewBot(gobot.WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^echo (.+)$`), "*echo*: Repeats something.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			return w.Reply(fmt.Sprintf("<@%s> said %s", r.User, r.Captures[1]))
+		}))
+	b.RegisterHandler(regexp.MustCompile(`^whisper (.+)$`), "*whisper*: Repeats something privately.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			return w.DM(r.User, r.Captures[1])
+		}))
+
+	go b.Start(context.Background())
+	conn := d.accept()
+	identify := conn.expect(t, opIdentify)
+	if identify["token"] != "token" || identify["intents"] != float64(DefaultIntents) {
+		t.Errorf("Unexpected identify %v", identify)
+	}
+	conn.ready(d)
+
+	conn.dispatch(2, "MESSAGE_CREATE", message("1", "g1", "c1", "200", "echo unaddressed"))
+	conn.dispatch(3, "MESSAGE_CREATE", message("2", "g1", "c1", "200", "<@!100> echo hi"))
+	if msg := d.nextMessage(); msg != "c1: <@200> said hi" {
+		t.Errorf("Unexpected reply %q", msg)
+	}
+	conn.dispatch(4, "MESSAGE_CREATE", message("3", "", "55", "300", "echo secret"))
+	if msg := d.nextMessage(); msg != "55: <@300> said secret" {
+		t.Errorf("Unexpected DM reply %q", msg)
+	}
+	conn.dispatch(5, "MESSAGE_CREATE", message("4", "g1", "c1", "200", "<@100> whisper psst"))
+	if msg := d.nextMessage(); msg != "dm-200: psst" {
+		t.Errorf("Unexpected DM %q", msg)
+	}
+
+	conn.WriteJSON(map[string]interface{}{"op": opHeartbeat, "d": nil})
+	if beat := conn.expect(t, opHeartbeat); string(beat["d"].(json.RawMessage)) != "5" {
+		t.Errorf("Expected a heartbeat with the last sequence number, got %s", beat["d"])
+	}
+
+	// Asked to reconnect, the client resumes on the resume URL and gets the events it missed.
+	conn.WriteJSON(map[string]interface{}{"op": opReconnect, "d": nil})
+	resumed := d.accept()
+	if resumed.path != "/resume" {
+		t.Errorf("Expected to resume on /resume, got %s", resumed.path)
+	}
+	resume := resumed.expect(t, opResume)
+	if resume["session_id"] != "session" || resume["seq"] != float64(5) || resume["token"] != "token" {
+		t.Errorf("Unexpected resume %v", resume)
+	}
+	resumed.dispatch(6, "MESSAGE_CREATE", message("5", "g1", "c1", "200", "<@100> echo missed"))
+	resumed.dispatch(7, "RESUMED", nil)
+	if msg := d.nextMessage(); msg != "c1: <@200> said missed" {
+		t.Errorf("Unexpected reply after resuming %q", msg)
+	}
+
+	b.Stop()
+	if err := b.Wait(); err != nil {
+		t.Errorf("Expected a clean shutdown, got %s", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) *transporttest.Fixture {
+		d := newFakeDiscord(t, 45000)
+		transport := d.newTransport()
+
+		connected := make(chan error)
+		go func() {
+			_, err := transport.Connect(context.Background())
+			connected <- err
+		}()
+		conn := d.accept()
+		conn.expect(t, opIdentify)
+		conn.ready(d)
+		if err := <-connected; err != nil {
+			t.Fatal(err)
+		}
+
+		seq := 1
+		return &transporttest.Fixture{
+			Transport: transport,
+			Deliver: func(text string) {
+				seq++
+				conn.dispatch(seq, "MESSAGE_CREATE", message(fmt.Sprint(seq), "g1", "c1", "200", text))
+			},
+			Sent: func() string {
+				msg := d.nextMessage()
+				return msg[strings.Index(msg, ": ")+2:]
+			},
+			Drop: func() {
+				conn.Close()
+				conn = d.accept()
+				conn.expect(t, opResume)
+				conn.dispatch(seq, "RESUMED", nil)
+			},
+		}
+	})
+}
+
+func TestUnacknowledgedHeartbeatResumes(t *testing.T) {
+	d := newFakeDiscord(t, 20)
+	transport := d.newTransport()
+
+	connected := make(chan error)
+	go func() {
+		_, err := transport.Connect(context.Background())
+		connected <- err
+	}()
+	conn := d.accept()
+	conn.expect(t, opIdentify)
+	conn.ready(d)
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	// The heartbeats go unanswered, so the client gives up on the connection.
+	conn.expect(t, opHeartbeat)
+	resumed := d.accept()
+	if resumed.path != "/resume" {
+		t.Errorf("Expected to resume on /resume, got %s", resumed.path)
+	}
+	resumed.expect(t, opResume)
+}
+
+func TestInvalidSessionIdentifiesAgain(t *testing.T) {
+	d := newFakeDiscord(t, 45000)
+	transport := d.newTransport()
+
+	connected := make(chan error)
+	go func() {
+		_, err := transport.Connect(context.Background())
+		connected <- err
+	}()
+	conn := d.accept()
+	conn.expect(t, opIdentify)
+	conn.ready(d)
+	if err := <-connected; err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	conn.WriteJSON(map[string]interface{}{"op": opInvalidSession, "d": false})
+	fresh := d.accept()
+	if fresh.path != "/gateway" {
+		t.Errorf("Expected a fresh connection to /gateway, got %s", fresh.path)
+	}
+	fresh.expect(t, opIdentify)
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	d := newFakeDiscord(t, 45000)
+	transport := d.newTransport()
+
+	connected := make(chan error)
+	go func() {
+		_, err := transport.Connect(context.Background())
+		connected <- err
+	}()
+	conn := d.accept()
+	conn.expect(t, opIdentify)
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4004, "Authentication failed."))
+
+	err := <-connected
+	if _, fatal := err.(*fatalError); !fatal || !strings.Contains(err.Error(), "4004") {
+		t.Errorf("Expected a fatal 4004 error, got %v", err)
+	}
+}
+
+func TestSendRetriesWhenRateLimited(t *testing.T) {
+	d := newFakeDiscord(t, 45000)
+	transport := d.newTransport()
+	atomic.StoreInt32(&d.rateLimited, 2)
+
+	msg := gobot.NewSlackMessage("c1", "hello")
+	msg.ThreadTS = "42"
+	if err := transport.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg := d.nextMessage(); msg != "c1 reply to 42: hello" {
+		t.Errorf("Unexpected message %q", msg)
+	}
+
+	atomic.StoreInt32(&d.rateLimited, maxRateLimitRetries+1)
+	err := transport.Send(context.Background(), gobot.NewSlackMessage("c1", "hello"))
+	if httpErr, ok := err.(*gobot.HTTPError); !ok || httpErr.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected a rate limit error, got %v", err)
+	}
+}
+
+func TestSplitContent(t *testing.T) {
+	lines := strings.Repeat(strings.Repeat("x", 99)+"\n", 30)
+	pieces := splitContent(lines)
+	if len(pieces) != 2 || len(pieces[0]) != 1999 || strings.Join(pieces, "\n") != lines {
+		t.Errorf("Expected the text to be split at a newline, got pieces of %d and %d bytes", len(pieces[0]), len(pieces[len(pieces)-1]))
+	}
+
+	runes := splitContent(strings.Repeat("é", maxContent+1))
+	if len(runes) != 2 || len(runes[0]) != 2*maxContent || runes[1] != "é" {
+		t.Errorf("Expected the limit to count characters, got %d pieces", len(runes))
+	}
+
+	if pieces := splitContent(""); len(pieces) != 0 {
+		t.Errorf("Expected nothing to send for empty text, got %q", pieces)
+	}
+}
+
+func TestNewUsesDiscordEndpoints(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("Expected an error without a token")
+	}
+
+	transport, err := New(Config{Token: "token", APIURL: "http://localhost:8080/api/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.cfg.APIURL != "http://localhost:8080/api" || transport.cfg.GatewayURL != defaultGatewayURL {
+		t.Errorf("Unexpected endpoints %s and %s", transport.cfg.APIURL, transport.cfg.GatewayURL)
+	}
+	if transport.cfg.Intents != DefaultIntents {
+		t.Errorf("Expected DefaultIntents, got %d", transport.cfg.Intents)
+	}
+}
@@ -0,0 +1,243 @@
+package discord
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/jlindsey/gobot"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Gateway opcodes. See https://discord.com/developers/docs/topics/opcodes-and-status-codes.
+const (
+	opDispatch       = 0
+	opHeartbeat      = 1
+	opIdentify       = 2
+	opResume         = 6
+	opReconnect      = 7
+	opInvalidSession = 9
+	opHello          = 10
+	opHeartbeatAck   = 11
+)
+
+// gatewayQuery selects the gateway version and encoding the transport speaks.
+const gatewayQuery = "?v=10&encoding=json"
+
+// helloTimeout bounds how long a new gateway connection may take to say hello.
+const helloTimeout = 30 * time.Second
+
+// payload is a single frame received from the gateway.
+type payload struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+	S  int64           `json:"s"`
+	T  string          `json:"t"`
+}
+
+// command is a single frame sent to the gateway.
+type command struct {
+	Op int         `json:"op"`
+	D  interface{} `json:"d"`
+}
+
+// readyEvent is the part of the READY dispatch the transport needs.
+type readyEvent struct {
+	User             user   `json:"user"`
+	SessionID        string `json:"session_id"`
+	ResumeGatewayURL string `json:"resume_gateway_url"`
+}
+
+/*
+fatalError is a gateway failure that reconnecting can't fix, such as a bad
+token or intents the application isn't allowed.
+*/
+type fatalError struct {
+	err error
+}
+
+func (e *fatalError) Error() string {
+	return e.err.Error()
+}
+
+// errReconnectRequested is returned when Discord asks the client to reconnect and resume.
+var errReconnectRequested = errors.New("Discord requested a reconnect")
+
+/*
+closeError interprets the close code Discord ended a connection with. Codes
+for problems with the bot's configuration are fatal, and a few others mean
+the session can't be resumed.
+*/
+func (t *Transport) closeError(err error) error {
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok {
+		return err
+	}
+
+	switch closeErr.Code {
+	case 4004, 4010, 4011, 4012, 4013, 4014:
+		return &fatalError{fmt.Errorf("Discord closed the gateway: %d %s", closeErr.Code, closeErr.Text)}
+	case 4007, 4009:
+		t.forgetSession()
+	}
+	return err
+}
+
+// dial opens a gateway connection and returns it with the heartbeat interval from its hello.
+func (t *Transport) dial(gatewayURL string) (*websocket.Conn, time.Duration, error) {
+	t.log.Infof("Dialing Discord gateway at %s", gatewayURL)
+	conn, _, err := t.dialer.Dial(gatewayURL+gatewayQuery, http.Header{"User-Agent": []string{userAgent}})
+	if err != nil {
+		return nil, 0, &gobot.DialError{URL: gatewayURL, Err: err}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	var hello payload
+	if err := conn.ReadJSON(&hello); err != nil {
+		conn.Close()
+		return nil, 0, t.closeError(err)
+	}
+	var data struct {
+		HeartbeatInterval int64 `json:"heartbeat_interval"`
+	}
+	if hello.Op != opHello || json.Unmarshal(hello.D, &data) != nil || data.HeartbeatInterval <= 0 {
+		conn.Close()
+		return nil, 0, fmt.Errorf("Expected hello from the Discord gateway, got opcode %d", hello.Op)
+	}
+	return conn, time.Duration(data.HeartbeatInterval) * time.Millisecond, nil
+}
+
+func (t *Transport) identify(conn *websocket.Conn) error {
+	return t.write(conn, command{Op: opIdentify, D: map[string]interface{}{
+		"token":   t.cfg.Token,
+		"intents": t.cfg.Intents,
+		"properties": map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "gobot",
+			"device":  "gobot",
+		},
+	}})
+}
+
+func (t *Transport) resume(conn *websocket.Conn, sessionID string) error {
+	return t.write(conn, command{Op: opResume, D: map[string]interface{}{
+		"token":      t.cfg.Token,
+		"session_id": sessionID,
+		"seq":        atomic.LoadInt64(&t.seq),
+	}})
+}
+
+// heartbeat sends a heartbeat carrying the last sequence number received, or null before any.
+func (t *Transport) heartbeat(conn *websocket.Conn) error {
+	var seq interface{}
+	if s := atomic.LoadInt64(&t.seq); s > 0 {
+		seq = s
+	}
+	return t.write(conn, command{Op: opHeartbeat, D: seq})
+}
+
+func (t *Transport) write(conn *websocket.Conn, cmd command) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return conn.WriteJSON(cmd)
+}
+
+/*
+keepAlive heartbeats conn every interval until done is closed, starting
+after a random fraction of the interval as Discord asks. If a heartbeat
+goes unacknowledged by the time the next one is due, the connection is
+assumed dead and closed, so serve returns and the session is resumed.
+*/
+func (t *Transport) keepAlive(conn *websocket.Conn, interval time.Duration, acked *int32, done chan struct{}) {
+	wait := time.Duration(rand.Int63n(int64(interval)))
+	atomic.StoreInt32(acked, 1)
+
+	for {
+		select {
+		case <-time.After(wait):
+		case <-done:
+			return
+		}
+		wait = interval
+
+		if !atomic.CompareAndSwapInt32(acked, 1, 0) {
+			t.log.Warning("Discord didn't acknowledge the last heartbeat; reconnecting")
+			conn.Close()
+			return
+		}
+		if err := t.heartbeat(conn); err != nil {
+			t.log.Errorf("Unable to send heartbeat: %s", err)
+		}
+	}
+}
+
+/*
+serve reads from conn until it fails, delivering messages and answering
+the gateway's requests, and returns why it stopped.
+*/
+func (t *Transport) serve(conn *websocket.Conn, interval time.Duration) error {
+	var acked int32
+	done := make(chan struct{})
+	defer close(done)
+	go t.keepAlive(conn, interval, &acked, done)
+
+	for {
+		conn.SetReadDeadline(time.Time{})
+		var p payload
+		if err := conn.ReadJSON(&p); err != nil {
+			return t.closeError(err)
+		}
+
+		switch p.Op {
+		case opDispatch:
+			atomic.StoreInt64(&t.seq, p.S)
+			t.dispatch(p)
+		case opHeartbeat:
+			if err := t.heartbeat(conn); err != nil {
+				return err
+			}
+		case opHeartbeatAck:
+			atomic.StoreInt32(&acked, 1)
+		case opReconnect:
+			return errReconnectRequested
+		case opInvalidSession:
+			var resumable bool
+			json.Unmarshal(p.D, &resumable)
+			if !resumable {
+				t.forgetSession()
+			}
+			return errors.New("Discord invalidated the session")
+		}
+	}
+}
+
+// dispatch handles a gateway event.
+func (t *Transport) dispatch(p payload) {
+	switch p.T {
+	case "READY":
+		var ready readyEvent
+		if err := json.Unmarshal(p.D, &ready); err != nil {
+			t.log.Errorf("Unable to parse READY: %s", err)
+			return
+		}
+		t.setSession(ready)
+	case "RESUMED":
+		t.log.Info("Resumed Discord session")
+	case "MESSAGE_CREATE":
+		var m discordMessage
+		if err := json.Unmarshal(p.D, &m); err != nil {
+			t.log.Errorf("Unable to parse MESSAGE_CREATE: %s", err)
+			return
+		}
+		msg := m.incoming()
+		msg.Raw = p.D
+		select {
+		case t.incoming <- msg:
+		case <-t.closed:
+		}
+	}
+}
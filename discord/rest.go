@@ -0,0 +1,89 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jlindsey/gobot"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// maxRateLimitRetries bounds how many times a rate limited REST call is retried.
+const maxRateLimitRetries = 3
+
+// apiError is the body of a failed Discord REST call.
+type apiError struct {
+	Code       int     `json:"code"`
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+}
+
+/*
+call makes a REST API call authenticated with the bot token, sending in as
+the JSON body and decoding the response into out if it isn't nil. Rate
+limited calls are retried after the delay Discord asks for. Failures are
+returned as *gobot.HTTPError, with Discord's error message as the cause
+where it gave one.
+*/
+func (t *Transport) call(ctx context.Context, method, path string, in, out interface{}) error {
+	endpoint := t.cfg.APIURL + path
+
+	var encoded []byte
+	if in != nil {
+		var err error
+		if encoded, err = json.Marshal(in); err != nil {
+			return &gobot.HTTPError{Endpoint: endpoint, Err: err}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(encoded))
+		if err != nil {
+			return &gobot.HTTPError{Endpoint: endpoint, Err: err}
+		}
+		req.Header.Set("Authorization", "Bot "+t.cfg.Token)
+		req.Header.Set("User-Agent", userAgent)
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := t.cfg.HTTPClient.Do(req)
+		if err != nil {
+			return &gobot.HTTPError{Endpoint: endpoint, Err: err}
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return &gobot.HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Err: err}
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			if out != nil {
+				if err := json.Unmarshal(body, out); err != nil {
+					return &gobot.HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Err: err}
+				}
+			}
+			return nil
+		}
+
+		httpErr := &gobot.HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+		var failure apiError
+		if json.Unmarshal(body, &failure) == nil && failure.Message != "" {
+			httpErr.Err = errors.New(failure.Message)
+		}
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			return httpErr
+		}
+
+		wait := time.Duration(failure.RetryAfter * float64(time.Second))
+		t.log.Warningf("Rate limited by Discord, retrying %s %s in %s", method, path, wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
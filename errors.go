@@ -0,0 +1,68 @@
+package gobot
+
+import (
+	"fmt"
+)
+
+/*
+MissingTokenError is returned by NewBot when no Slack API token could be
+found in the environment.
+*/
+type MissingTokenError struct {
+	EnvKey string
+}
+
+func (e *MissingTokenError) Error() string {
+	return fmt.Sprintf("Can't find slack token in env var %s", e.EnvKey)
+}
+
+/*
+HTTPError is returned when a call to the Slack Web API fails at the HTTP
+level: the request could not be made, the response was not a 200, or the
+body could not be read or parsed. Err holds the underlying cause, if any.
+*/
+type HTTPError struct {
+	Endpoint   string
+	StatusCode int
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("Unexpected HTTP status %d from %s", e.StatusCode, e.Endpoint)
+	}
+	return fmt.Sprintf("Request to %s failed: %s", e.Endpoint, e.Err)
+}
+
+// Unwrap returns the underlying cause of the failure.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+/*
+SlackError is returned when Slack answers a Web API call with "ok": false.
+Message holds the "error" string from the response, eg. "invalid_auth".
+*/
+type SlackError struct {
+	Method  string
+	Message string
+}
+
+func (e *SlackError) Error() string {
+	return fmt.Sprintf("Bad response from %s call: %s", e.Method, e.Message)
+}
+
+// DialError is returned when the websocket connection to Slack can't be opened.
+type DialError struct {
+	URL string
+	Err error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("Unable to open websocket to %s: %s", e.URL, e.Err)
+}
+
+// Unwrap returns the underlying cause of the failure.
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
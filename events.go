@@ -0,0 +1,225 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+eventRetention is how long delivered event IDs are remembered. Slack retries
+an unacknowledged event up to three times over roughly half an hour.
+*/
+const eventRetention = time.Hour
+
+// eventEnvelope is the outer body of an Events API request.
+type eventEnvelope struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	EventID   string          `json:"event_id"`
+	Event     json.RawMessage `json:"event"`
+}
+
+/*
+eventsTransport receives events pushed by Slack to the app's Request URL.
+It is an http.Handler, exposed through Bot.EventsHandler. Everything is sent
+through the Web API.
+*/
+type eventsTransport struct {
+	*slackClient
+	signingSecret string
+	seenEvents    *eventLog
+
+	incoming  chan *IncomingMessage
+	connected int32
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newEventsTransport(api *slackClient, signingSecret string) *eventsTransport {
+	return &eventsTransport{
+		slackClient:   api,
+		signingSecret: signingSecret,
+		seenEvents:    newEventLog(eventRetention),
+		incoming:      make(chan *IncomingMessage),
+		closed:        make(chan struct{}),
+	}
+}
+
+/*
+EventsHandler returns the http.Handler to use as the app's Events API
+Request URL when the bot was created with WithEventsAPI. It answers Slack's
+url_verification challenge, verifies every request with the signing secret,
+drops retries of events it has already accepted and feeds message events
+into the same pipeline as the RTM websocket.
+
+The handler only accepts events while the bot is running; until Start is
+called, and after Stop, events are refused with 503 so Slack retries them.
+Bots using any other transport answer every request with 404.
+*/
+func (b *Bot) EventsHandler() http.Handler {
+	if t, ok := b.transport.(*eventsTransport); ok {
+		return t
+	}
+	return http.NotFoundHandler()
+}
+
+// Connect implements Transport.
+func (t *eventsTransport) Connect(ctx context.Context) (*Identity, error) {
+	// Events that arrive while we identify ourselves wait for the bot to start receiving.
+	atomic.StoreInt32(&t.connected, 1)
+
+	self, err := t.identify(ctx)
+	if err != nil {
+		atomic.StoreInt32(&t.connected, 0)
+		return nil, err
+	}
+	return self, nil
+}
+
+// Receive implements Transport.
+func (t *eventsTransport) Receive(ctx context.Context) (*IncomingMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.closed:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Send implements Transport.
+func (t *eventsTransport) Send(ctx context.Context, msg *SlackMessage) error {
+	return t.postQueuedMessage(ctx, msg)
+}
+
+// Close implements Transport.
+func (t *eventsTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+func (t *eventsTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := verifySlackRequest(t.signingSecret, r)
+	if err != nil {
+		t.log.Warningf("Rejecting event: %s", err)
+		http.Error(w, "invalid request", http.StatusUnauthorized)
+		return
+	}
+
+	var envelope eventEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.log.Errorf("Unable to parse event: %s", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	switch envelope.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"challenge": envelope.Challenge})
+		return
+	case "event_callback":
+	default:
+		t.log.Debugf("Ignoring %s event", envelope.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if atomic.LoadInt32(&t.connected) == 0 {
+		http.Error(w, "bot unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !t.seenEvents.add(envelope.EventID) {
+		t.log.Debugf("Dropping retry %s of event %s (%s)",
+			r.Header.Get("X-Slack-Retry-Num"), envelope.EventID, r.Header.Get("X-Slack-Retry-Reason"))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// The envelope was fine, so an event the bot can't use is still acknowledged; Slack would only retry it.
+	msg, err := ParseIncomingMessage(envelope.Event)
+	if err != nil {
+		t.log.Warningf("Ignoring event %s: %s", envelope.EventID, err)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	select {
+	case t.incoming <- msg:
+	case <-t.closed:
+		t.seenEvents.forget(envelope.EventID)
+		http.Error(w, "bot unavailable", http.StatusServiceUnavailable)
+		return
+	case <-r.Context().Done():
+		t.seenEvents.forget(envelope.EventID)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+identify asks auth.test who the bot is, which stands in for rtm.start when
+the bot isn't using the RTM websocket.
+*/
+func (c *slackClient) identify(ctx context.Context) (*Identity, error) {
+	c.log.Info("Calling Slack auth.test")
+
+	parsedBody, err := c.callAPI(ctx, "auth.test", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	self := &Identity{}
+	self.Team, _ = parsedBody.Path("team").Data().(string)
+	self.Name, _ = parsedBody.Path("user").Data().(string)
+	self.ID, _ = parsedBody.Path("user_id").Data().(string)
+	return self, nil
+}
+
+// eventLog remembers recently delivered event IDs so retries can be dropped.
+type eventLog struct {
+	retention time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newEventLog(retention time.Duration) *eventLog {
+	return &eventLog{retention: retention, seen: make(map[string]time.Time)}
+}
+
+/*
+add records id as delivered, reporting false if it already was within the
+retention period. Expired IDs are forgotten along the way.
+*/
+func (l *eventLog) add(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for old, at := range l.seen {
+		if now.Sub(at) >= l.retention {
+			delete(l.seen, old)
+		}
+	}
+	if _, ok := l.seen[id]; ok {
+		return false
+	}
+	l.seen[id] = now
+	return true
+}
+
+// forget removes id so a retry of an event that couldn't be delivered is accepted.
+func (l *eventLog) forget(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.seen, id)
+}
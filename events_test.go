@@ -0,0 +1,128 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func signedEvent(t *testing.T, secret string, event map[string]interface{}) *http.Request {
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signedRequest(t, secret, "/slack/events", "application/json", string(body))
+}
+
+func TestEventsAPIRequiresSigningSecret(t *testing.T) {
+	if _, err := NewBot(WithToken("xoxb-test"), WithEventsAPI()); err == nil {
+		t.Error("Expected NewBot to fail without a signing secret")
+	}
+}
+
+func TestEventsURLVerification(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithSigningSecret("shh"), WithEventsAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	b.EventsHandler().ServeHTTP(rec, signedEvent(t, "shh", map[string]interface{}{
+		"type":      "url_verification",
+		"challenge": "abc123",
+	}))
+
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp["challenge"] != "abc123" {
+		t.Errorf("Unexpected challenge response: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	b.EventsHandler().ServeHTTP(rec, signedEvent(t, "wrong", map[string]interface{}{"type": "url_verification"}))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	b.EventsHandler().ServeHTTP(rec, signedRequest(t, "shh", "/slack/events", "application/json", "not json"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a malformed envelope, got %d", rec.Code)
+	}
+}
+
+func TestEventsDispatchOverWebAPI(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.responses["auth.test"] = map[string]interface{}{
+		"ok": true, "team": "Test Team", "user": "gobot", "user_id": "U0BOT",
+	}
+
+	b, err := NewBot(append(slack.options(), WithSigningSecret("shh"), WithEventsAPI())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile("^ping$"), "*ping*: Replies pong.", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		return w.Reply("pong")
+	}))
+
+	go b.Start(context.Background())
+	if call := <-slack.calls; call.method != "auth.test" {
+		t.Fatalf("Expected auth.test, got %s", call.method)
+	}
+
+	event := map[string]interface{}{
+		"type":     "event_callback",
+		"event_id": "Ev1",
+		"event":    map[string]string{"type": "message", "channel": "C1", "user": "U1", "text": "<@U0BOT> ping", "ts": "1.0"},
+	}
+	rec := httptest.NewRecorder()
+	b.EventsHandler().ServeHTTP(rec, signedEvent(t, "shh", event))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	// Events the bot can't use are still acknowledged, so Slack doesn't retry them.
+	for i, unusable := range []map[string]interface{}{
+		{"type": "message", "channel": "C1", "text": 5},
+		{"type": "user_change", "user": map[string]string{"id": "U1"}},
+	} {
+		rec = httptest.NewRecorder()
+		b.EventsHandler().ServeHTTP(rec, signedEvent(t, "shh", map[string]interface{}{
+			"type": "event_callback", "event_id": "Ev" + strconv.Itoa(i+2), "event": unusable,
+		}))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected %v to be acknowledged, got %d", unusable, rec.Code)
+		}
+	}
+
+	retry := signedEvent(t, "shh", event)
+	retry.Header.Set("X-Slack-Retry-Num", "1")
+	retry.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+	rec = httptest.NewRecorder()
+	b.EventsHandler().ServeHTTP(rec, retry)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected retry to be acknowledged, got %d", rec.Code)
+	}
+
+	call := <-slack.calls
+	if call.method != "chat.postMessage" {
+		t.Fatalf("Expected chat.postMessage, got %s", call.method)
+	}
+	if call.params.Get("channel") != "C1" || call.params.Get("text") != "pong" {
+		t.Errorf("Unexpected reply: %s", call.body)
+	}
+
+	b.Stop()
+	if err := b.Wait(); err != nil {
+		t.Errorf("Expected a clean shutdown, got %s", err)
+	}
+	select {
+	case call := <-slack.calls:
+		t.Errorf("Retry was dispatched again: %s %s", call.method, call.body)
+	default:
+	}
+}
@@ -1,6 +1,7 @@
 package gobot_test
 
 import (
+	"context"
 	"github.com/jlindsey/gobot"
 )
 
@@ -26,7 +27,10 @@ func (p PingCommand) Run(channel string, text string, out chan *gobot.SlackMessa
 
 // Main entry point
 func Example() {
-	bot := gobot.NewBot()
+	bot, err := gobot.NewBot()
+	if err != nil {
+		gobot.Log.Fatal(err)
+	}
 	bot.RegisterCommand(PingCommand{})
-	bot.Start()
+	bot.MustStart(context.Background())
 }
@@ -0,0 +1,46 @@
+package gobot
+
+/*
+BotPolicy controls whether messages posted by other bots (those with a
+bot_id or the "bot_message" subtype) may trigger commands and listeners.
+The bot's own messages are always ignored, whatever the policy.
+*/
+type BotPolicy int
+
+const (
+	// IgnoreBots drops every message from another bot. This is the default.
+	IgnoreBots BotPolicy = iota
+	// AllowBots treats messages from other bots like any other message.
+	AllowBots
+	// AllowListedBots only accepts messages from the bot IDs given to WithBotPolicy.
+	AllowListedBots
+)
+
+// isFromBot reports whether msg was posted by a bot integration.
+func (m *IncomingMessage) isFromBot() bool {
+	return m.BotID != "" || m.Subtype == "bot_message"
+}
+
+/*
+acceptSender reports whether msg may be dispatched at all. It filters out
+the bot's own messages, so that a reply can never trigger the bot again,
+and applies the bot policy to messages from other bots.
+*/
+func (b *Bot) acceptSender(msg *IncomingMessage) bool {
+	if msg.User != "" && msg.User == b.selfID {
+		return false
+	}
+
+	if !msg.isFromBot() {
+		return true
+	}
+
+	switch b.botPolicy {
+	case AllowBots:
+		return true
+	case AllowListedBots:
+		return b.allowedBots[msg.BotID]
+	default:
+		return false
+	}
+}
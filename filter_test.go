@@ -0,0 +1,68 @@
+package gobot
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestSelfReplyDoesNotLoop(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+
+	runs := 0
+	b.RegisterListener(regexp.MustCompile(`echo`), HandlerFunc(func(w ResponseWriter, r *Request) error {
+		runs++
+		return w.Reply("echo " + r.Text)
+	}))
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "text": "echo"}`)
+
+	// Feed the bot's reply back in, as Slack would over RTM.
+	for i := 0; i < 3 && len(b.sendQueue) > 0; i++ {
+		reply := <-b.sendQueue
+		raw, _ := json.Marshal(map[string]string{
+			"type": "message", "channel": reply.Channel, "user": "U0BOT", "text": reply.Text,
+		})
+		dispatch(t, b, string(raw))
+	}
+
+	if runs != 1 {
+		t.Errorf("Expected the listener to run once, ran %d times", runs)
+	}
+}
+
+func TestBotPolicy(t *testing.T) {
+	events := []string{
+		`{"type": "message", "channel": "C1", "user": "U1", "text": "<@U0BOT> ping"}`,
+		`{"type": "message", "channel": "C1", "bot_id": "B1", "subtype": "bot_message", "text": "<@U0BOT> ping"}`,
+		`{"type": "message", "channel": "C1", "user": "U2", "bot_id": "B2", "text": "<@U0BOT> ping"}`,
+		`{"type": "message", "channel": "C1", "user": "U0BOT", "text": "<@U0BOT> ping"}`,
+	}
+
+	cases := []struct {
+		option Option
+		want   int
+	}{
+		{WithBotPolicy(IgnoreBots), 1},
+		{WithBotPolicy(AllowBots), 3},
+		{WithBotPolicy(AllowListedBots, "B2"), 2},
+	}
+
+	for _, c := range cases {
+		b, err := NewBot(WithToken("xoxb-test"), c.option)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.setIdentity(&Identity{ID: "U0BOT"})
+
+		ran := make(chan string, len(events))
+		b.RegisterCommand(recordCommand{"ping", ran})
+		for _, e := range events {
+			dispatch(t, b, e)
+		}
+
+		if len(ran) != c.want {
+			t.Errorf("Policy %d: expected %d runs, got %d", b.botPolicy, c.want, len(ran))
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package gobot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+/*
+Handler responds to a message directed at the bot. It is the richer
+alternative to Command: instead of a channel name and text it receives a
+Request describing who said what, where, and a ResponseWriter for replying.
+
+Handlers are registered with RegisterHandler. Existing Command
+implementations keep working through RegisterCommand, which adapts them
+to this interface.
+*/
+type Handler interface {
+	Handle(w ResponseWriter, r *Request) error
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface.
+type HandlerFunc func(w ResponseWriter, r *Request) error
+
+// Handle calls f(w, r).
+func (f HandlerFunc) Handle(w ResponseWriter, r *Request) error {
+	return f(w, r)
+}
+
+/*
+Request describes the message that triggered a Handler.
+
+Text is the message text with the bot mention stripped. Captures holds the
+submatches of the handler's pattern against Text (Captures[0] is the whole
+match) and Params the named submatches. Message is the full incoming event,
+including the Raw payload.
+*/
+type Request struct {
+	ctx context.Context
+
+	User     string
+	Channel  string
+	TS       string
+	ThreadTS string
+	Text     string
+
+	Captures []string
+	Params   map[string]string
+
+	Message *IncomingMessage
+	Bot     *Bot
+}
+
+/*
+Context returns the request's context, which is cancelled when the bot
+begins shutting down.
+*/
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+/*
+ResponseWriter is used by a Handler to respond to a Request.
+
+Reply posts to the channel the request came from, and ReplyInThread starts
+or continues a thread on the triggering message. React adds an emoji
+reaction (eg. "thumbsup") to the triggering message. DM sends a direct
+message to the given user. Send queues an arbitrary message.
+
+If the triggering message was itself in a thread, replies to the same
+channel stay in that thread unless they set their own ThreadTS. Bots
+configured WithThreadedReplies also move long replies into a thread.
+*/
+type ResponseWriter interface {
+	Send(msg *SlackMessage) error
+	Reply(text string) error
+	ReplyInThread(text string) error
+	React(emoji string) error
+	DM(user string, text string) error
+}
+
+// errBotStopped is returned by ResponseWriter methods once the bot has stopped.
+var errBotStopped = errors.New("Bot has stopped")
+
+// responseWriter is the ResponseWriter handed to handlers for incoming messages.
+type responseWriter struct {
+	bot *Bot
+	req *Request
+}
+
+func (w *responseWriter) Send(msg *SlackMessage) error {
+	w.bot.threadReply(w.req, msg)
+
+	select {
+	case w.bot.sendQueue <- msg:
+		return nil
+	case <-w.bot.finished:
+		return errBotStopped
+	}
+}
+
+func (w *responseWriter) Reply(text string) error {
+	return w.Send(NewSlackMessage(w.req.Channel, text))
+}
+
+func (w *responseWriter) ReplyInThread(text string) error {
+	msg := NewSlackMessage(w.req.Channel, text)
+	msg.ThreadTS = w.req.ThreadTS
+	if msg.ThreadTS == "" {
+		msg.ThreadTS = w.req.TS
+	}
+	return w.Send(msg)
+}
+
+func (w *responseWriter) React(emoji string) error {
+	return w.bot.react(w.req.Context(), w.req.Channel, w.req.TS, emoji)
+}
+
+func (w *responseWriter) DM(user string, text string) error {
+	channel, err := w.bot.openDM(w.req.Context(), user)
+	if err != nil {
+		return err
+	}
+	return w.Send(NewSlackMessage(channel, text))
+}
+
+/*
+threadReply decides whether msg, a reply to req, belongs in a thread. Replies
+to threaded messages stay in the thread, and replies of at least
+threadedReplyLength characters start one on the triggering message.
+*/
+func (b *Bot) threadReply(req *Request, msg *SlackMessage) {
+	if msg.ThreadTS != "" || msg.Channel != req.Channel {
+		return
+	}
+
+	switch {
+	case req.ThreadTS != "":
+		msg.ThreadTS = req.ThreadTS
+	case b.threadedReplyLength > 0 && len(msg.Text) >= b.threadedReplyLength && req.TS != "":
+		msg.ThreadTS = req.TS
+	}
+}
+
+/*
+Route is a single entry in the bot's command registry: something that
+decides whether it matches a message, the help text describing it, and
+the Handler to run. Routes are returned by RegisterHandler so they can be
+configured further.
+*/
+type Route struct {
+	name    string
+	help    string
+	pattern *regexp.Regexp
+	match   func(text string) []string
+	handler Handler
+	scope   Scope
+}
+
+// String implements the Stringer interface.
+func (r *Route) String() string {
+	return r.name
+}
+
+/*
+RegisterHandler adds a Handler to the bot's command registry. The handler
+is triggered by messages directed at the bot whose text matches pattern;
+the submatches are passed along in Request.Captures and Request.Params.
+help is parsed the same way as Command.Help.
+
+Handlers and Commands share one registry and are tried in the order they
+were registered. Handlers run Anywhere unless restricted with Route.In.
+If h implements Interactive, its actions are registered too.
+*/
+func (b *Bot) RegisterHandler(pattern *regexp.Regexp, help string, h Handler) *Route {
+	b.log.Debugf("Registering handler: %s", pattern)
+	rt := &Route{
+		name:    fmt.Sprintf("Handler{pattern: %s}", pattern),
+		help:    help,
+		pattern: pattern,
+		match:   pattern.FindStringSubmatch,
+		handler: h,
+		scope:   Anywhere,
+	}
+	b.routes = append(b.routes, rt)
+	b.registerInteractive(h)
+	return rt
+}
+
+/*
+RegisterCommand adds a new command to the internal commands
+registry of the bot. This will allow those commands to be
+triggered by messages. See the documentation of the Command
+interface for mroe details.
+
+Commands run Anywhere unless they implement ScopedCommand. If c implements
+Interactive, its actions are registered too.
+*/
+func (b *Bot) RegisterCommand(c Command) {
+	b.log.Debugf("Registering command: %s", c)
+
+	scope := Anywhere
+	if sc, ok := c.(ScopedCommand); ok {
+		scope = sc.Scope()
+	}
+
+	b.routes = append(b.routes, &Route{
+		name: fmt.Sprint(c),
+		help: c.Help(),
+		match: func(text string) []string {
+			if c.Matches(text) {
+				return []string{text}
+			}
+			return nil
+		},
+		handler: commandHandler{c},
+		scope:   scope,
+	})
+	b.registerInteractive(c)
+}
+
+/*
+commandHandler adapts a Command to the Handler interface. Messages the
+command writes to its out channel are passed on to the ResponseWriter.
+*/
+type commandHandler struct {
+	cmd Command
+}
+
+func (h commandHandler) Handle(w ResponseWriter, r *Request) error {
+	out := make(chan *SlackMessage)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for msg := range out {
+			if err := w.Send(msg); err != nil {
+				r.Bot.log.Errorf("Unable to send message from %s: %s", h.cmd, err)
+			}
+		}
+	}()
+
+	var err error
+	if cc, ok := h.cmd.(ContextCommand); ok {
+		err = cc.RunContext(r.Context(), r.Message, out)
+	} else {
+		err = h.cmd.Run(r.Channel, r.Text, out)
+	}
+
+	close(out)
+	wg.Wait()
+
+	return err
+}
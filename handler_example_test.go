@@ -0,0 +1,26 @@
+package gobot_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/jlindsey/gobot"
+	"regexp"
+)
+
+// Register a Handler that reads a named capture and replies in a thread.
+func ExampleBot_RegisterHandler() {
+	b, err := gobot.NewBot()
+	if err != nil {
+		gobot.Log.Fatal(err)
+	}
+
+	b.RegisterHandler(regexp.MustCompile(`^greet (?P<name>\w+)$`), "*greet*: Says hello to someone.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			if err := w.React("wave"); err != nil {
+				return err
+			}
+			return w.ReplyInThread(fmt.Sprintf("Hello, %s! (asked by <@%s>)", r.Params["name"], r.User))
+		}))
+
+	b.MustStart(context.Background())
+}
@@ -0,0 +1,117 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"regexp"
+	"testing"
+)
+
+func TestHandlerReceivesRequest(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+
+	reqs := make(chan *Request, 1)
+	b.RegisterHandler(regexp.MustCompile(`^deploy (?P<app>\w+)$`), "*deploy*: Deploys an app.",
+		HandlerFunc(func(w ResponseWriter, r *Request) error {
+			reqs <- r
+			return nil
+		}))
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "ts": "1.5", "thread_ts": "1.0",
+		"text": "<@U0BOT>: deploy web"}`)
+
+	r := <-reqs
+	if r.User != "U1" || r.Channel != "C1" || r.TS != "1.5" || r.ThreadTS != "1.0" || r.Text != "deploy web" {
+		t.Errorf("Unexpected request: %+v", r)
+	}
+	if r.Params["app"] != "web" || len(r.Captures) != 2 {
+		t.Errorf("Unexpected captures: %v %v", r.Captures, r.Params)
+	}
+	if r.Bot != b || r.Message == nil {
+		t.Error("Expected the request to carry the bot and the raw event")
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.responses["conversations.open"] = map[string]interface{}{
+		"ok": true, "channel": map[string]interface{}{"id": "D1"},
+	}
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^hello$`), "", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		if err := w.React(":wave:"); err != nil {
+			return err
+		}
+		if err := w.ReplyInThread("hi there"); err != nil {
+			return err
+		}
+		return w.DM(r.User, "psst")
+	}))
+
+	go b.Start(context.Background())
+	defer b.Stop()
+	server := <-slack.conns
+	defer server.Close()
+
+	server.WriteMessage(websocket.TextMessage, []byte(`{"type": "message", "channel": "C1", "user": "U1", "ts": "1.5",
+		"text": "<@U0BOT> hello"}`))
+
+	call := <-slack.calls
+	if call.method != "reactions.add" || call.params.Get("name") != "wave" || call.params.Get("timestamp") != "1.5" {
+		t.Errorf("Unexpected reaction call: %+v", call)
+	}
+
+	var reply map[string]interface{}
+	if err = server.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply["channel"] != "C1" || reply["thread_ts"] != "1.5" || reply["text"] != "hi there" {
+		t.Errorf("Unexpected threaded reply: %v", reply)
+	}
+
+	if call = <-slack.calls; call.method != "conversations.open" || call.params.Get("users") != "U1" {
+		t.Errorf("Unexpected DM call: %+v", call)
+	}
+
+	var dm json.RawMessage
+	if err = server.ReadJSON(&dm); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := ParseIncomingMessage(dm); msg.Channel != "D1" || msg.Text != "psst" {
+		t.Errorf("Unexpected DM: %s", dm)
+	}
+}
+
+func TestRepliesFollowThreads(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithThreadedReplies(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	threaded := &Request{Channel: "C1", TS: "2.0", ThreadTS: "1.0"}
+	top := &Request{Channel: "C1", TS: "2.0"}
+
+	cases := []struct {
+		req  *Request
+		msg  *SlackMessage
+		want string
+	}{
+		{threaded, NewSlackMessage("C1", "ok"), "1.0"},
+		{threaded, NewSlackMessage("C2", "ok"), ""},
+		{top, NewSlackMessage("C1", "ok"), ""},
+		{top, NewSlackMessage("C1", "a much longer reply"), "2.0"},
+		{top, &SlackMessage{Channel: "C1", Text: "ok", ThreadTS: "0.5"}, "0.5"},
+	}
+
+	for i, c := range cases {
+		b.threadReply(c.req, c.msg)
+		if c.msg.ThreadTS != c.want {
+			t.Errorf("Case %d: expected thread %q, got %q", i, c.want, c.msg.ThreadTS)
+		}
+	}
+}
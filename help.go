@@ -23,7 +23,7 @@ type help struct {
 	long  string
 }
 
-func extractMatchesIntoMap(str string) map[string]string {
+func extractMatchesIntoMap(str string) (map[string]string, error) {
 	if !strings.HasSuffix(str, ".") {
 		str = str + "."
 	}
@@ -31,7 +31,9 @@ func extractMatchesIntoMap(str string) map[string]string {
 	names := helpParser.SubexpNames()[1:]
 	matches := helpParser.FindStringSubmatch(str)
 
-	Log.Debugf("Matches: %#v", matches)
+	if matches == nil {
+		return nil, fmt.Errorf(`Help text doesn't look like "*name*: description": %s`, str)
+	}
 
 	md := map[string]string{}
 
@@ -39,11 +41,14 @@ func extractMatchesIntoMap(str string) map[string]string {
 		md[names[i]] = s
 	}
 
-	return md
+	return md, nil
 }
 
 func parseHelpText(str string) (*help, error) {
-	md := extractMatchesIntoMap(str)
+	md, err := extractMatchesIntoMap(str)
+	if err != nil {
+		return nil, err
+	}
 
 	h := &help{}
 	h.name = strings.TrimSpace(md["name"])
@@ -62,41 +67,62 @@ func parseHelpText(str string) (*help, error) {
 }
 
 func (b *Bot) extractHelps() {
-	for _, cmd := range b.commands {
-		h, err := parseHelpText(cmd.Help())
+	for _, rt := range b.routes {
+		if rt.help == "" {
+			continue
+		}
+
+		h, err := parseHelpText(rt.help)
 		if err != nil {
-			Log.Error(err)
+			b.log.Errorf("Leaving %s out of help: %s", rt, err)
 			continue
 		}
+		b.log.Debugf("Help for %s: %#v", rt, h)
 
 		b.helps[h.name] = h
 	}
 }
 
-func (b *Bot) printCommandsHelp(toChannel string, trigger string) {
-	var buffer bytes.Buffer
+/*
+printCommandsHelp answers a help request the way a handler would reply to
+msg, so help asked for in a thread is answered there. With private help it
+goes by DM instead, falling back to the channel if the DM can't be opened.
+*/
+func (b *Bot) printCommandsHelp(msg *IncomingMessage, trigger string) {
+	w := &responseWriter{bot: b, req: b.newRequest(&Route{name: "help"}, msg, nil)}
+	text := b.helpText(trigger)
+
+	if b.privateHelp && !msg.DirectMessage && msg.User != "" {
+		err := w.DM(msg.User, text)
+		if err == nil || err == errBotStopped {
+			return
+		}
+		b.log.Errorf("Unable to send help by DM, replying in channel: %s", err)
+	}
+
+	if err := w.Reply(text); err != nil {
+		b.log.Errorf("Unable to send help: %s", err)
+	}
+}
 
+// helpText returns the reply to trigger: the list of commands, or the help for the one it names.
+func (b *Bot) helpText(trigger string) string {
 	if trigger == "help" {
+		var buffer bytes.Buffer
 		buffer.WriteString(fmt.Sprintln("_List Of Commands_"))
 		buffer.WriteString(fmt.Sprintln("*help*:  Displays this help message."))
 
 		for _, h := range b.helps {
 			buffer.WriteString(fmt.Sprintf("*%s*: %s\n", h.name, h.short))
 		}
+		return strings.TrimSpace(buffer.String())
+	}
 
-		b.sendQueue <- NewSlackMessage(toChannel, strings.TrimSpace(buffer.String()))
-	} else {
-		matches := helpTrigger.FindAllStringSubmatch(trigger, -1)[0]
-		name := matches[1]
-
-		h, ok := b.helps[name]
-
-		if ok {
-			b.sendQueue <- NewSlackMessage(toChannel, fmt.Sprintf("_%s_\n\n%s\n%s",
-				strings.ToTitle(h.name), h.short, h.long))
-			return
-		}
+	matches := helpTrigger.FindAllStringSubmatch(trigger, -1)[0]
+	name := matches[1]
 
-		b.sendQueue <- NewSlackMessage(toChannel, fmt.Sprintf("Sorry, there's no command called %s.", name))
+	if h, ok := b.helps[name]; ok {
+		return fmt.Sprintf("_%s_\n\n%s\n%s", strings.ToTitle(h.name), h.short, h.long)
 	}
+	return fmt.Sprintf("Sorry, there's no command called %s.", name)
 }
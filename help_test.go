@@ -0,0 +1,61 @@
+package gobot
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestFreeFormHandlerHelp(t *testing.T) {
+	transport := NewMemoryTransport(Identity{ID: "U0BOT", Name: "gobot"})
+	b, err := NewBot(WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply := HandlerFunc(func(w ResponseWriter, r *Request) error { return w.Reply("done") })
+	b.RegisterHandler(regexp.MustCompile(`^deploy$`), "deploy an app", reply)
+	b.RegisterHandler(regexp.MustCompile(`^status$`), "*status*: Shows deploy status.", reply)
+
+	go b.Start(context.Background())
+	defer b.Stop()
+
+	transport.Deliver(&IncomingMessage{Type: "message", Channel: "D1", User: "U1", Text: "help", DirectMessage: true})
+	msg := <-transport.Sent()
+	if !strings.Contains(msg.Text, "*status*") || strings.Contains(msg.Text, "deploy an app") {
+		t.Errorf("Expected help to list only parseable help texts, got %q", msg.Text)
+	}
+
+	transport.Deliver(&IncomingMessage{Type: "message", Channel: "D1", User: "U1", Text: "deploy", DirectMessage: true})
+	if msg := <-transport.Sent(); msg.Text != "done" {
+		t.Errorf("Expected the handler to still run, got %q", msg.Text)
+	}
+}
+
+func TestParseHelpText(t *testing.T) {
+	h, err := parseHelpText("*deploy*: Deploys an app. Pass the app name.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.name != "deploy" || h.short != "Deploys an app" || h.long != "Pass the app name." {
+		t.Errorf("Unexpected help %+v", h)
+	}
+
+	for _, text := range []string{"deploy an app", "*deploy*", ""} {
+		if _, err := parseHelpText(text); err == nil {
+			t.Errorf("Expected an error for help text %q", text)
+		}
+	}
+}
+
+func TestHelpInThread(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	b.RegisterCommand(recordCommand{"ping", make(chan string, 1)})
+	b.extractHelps()
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "ts": "1.5", "thread_ts": "1.0", "text": "<@U0BOT> help ping"}`)
+
+	if msg := <-b.sendQueue; msg.Channel != "C1" || msg.ThreadTS != "1.0" || !strings.Contains(msg.Text, "PING") {
+		t.Errorf("Expected help for ping in the thread, got %s", msg)
+	}
+}
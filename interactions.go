@@ -0,0 +1,226 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+/*
+Action describes a click on a button, or a choice in a select menu, in a
+message the bot posted. Value is the button's value or the selected
+option's value.
+*/
+type Action struct {
+	ActionID string
+	BlockID  string
+	Value    string
+
+	User        string
+	Channel     string
+	MessageTS   string
+	ThreadTS    string
+	ResponseURL string
+	TriggerID   string
+
+	// Raw is the whole interaction payload as Slack sent it.
+	Raw json.RawMessage
+}
+
+/*
+ActionResponder is used by an ActionHandler to respond to an Action.
+Update replaces the message that contained the clicked element, and
+FollowUp posts a new message to the same channel (in the same thread, if
+the original message was in one).
+*/
+type ActionResponder interface {
+	Update(msg *SlackMessage) error
+	FollowUp(msg *SlackMessage) error
+}
+
+// ActionHandler responds to clicks on interactive elements.
+type ActionHandler interface {
+	HandleAction(w ActionResponder, a *Action) error
+}
+
+// ActionHandlerFunc adapts an ordinary function to the ActionHandler interface.
+type ActionHandlerFunc func(w ActionResponder, a *Action) error
+
+// HandleAction calls f(w, a).
+func (f ActionHandlerFunc) HandleAction(w ActionResponder, a *Action) error {
+	return f(w, a)
+}
+
+/*
+Interactive is implemented by Commands and Handlers that post interactive
+elements and want to handle clicks on them in the same type. When one is
+registered with RegisterCommand or RegisterHandler, its HandleAction is
+also registered for each of the action IDs returned by ActionIDs.
+*/
+type Interactive interface {
+	ActionIDs() []string
+	HandleAction(w ActionResponder, a *Action) error
+}
+
+/*
+RegisterAction routes clicks on elements with the given action_id to h.
+Registering the same action_id twice replaces the earlier handler.
+*/
+func (b *Bot) RegisterAction(actionID string, h ActionHandler) {
+	b.log.Debugf("Registering action: %s", actionID)
+	b.actions[actionID] = h
+}
+
+// registerInteractive registers x's actions if it implements Interactive.
+func (b *Bot) registerInteractive(x interface{}) {
+	if i, ok := x.(Interactive); ok {
+		for _, id := range i.ActionIDs() {
+			b.RegisterAction(id, i)
+		}
+	}
+}
+
+/*
+InteractionHandler returns the http.Handler to use as the app's
+Interactivity Request URL. It verifies each request with the signing
+secret given to WithSigningSecret, acknowledges it immediately, and runs
+the ActionHandler registered for each action in the background.
+*/
+func (b *Bot) InteractionHandler() http.Handler {
+	return http.HandlerFunc(b.serveInteraction)
+}
+
+// interactionPayload is the subset of a block_actions payload we decode.
+type interactionPayload struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		TS       string `json:"ts"`
+		ThreadTS string `json:"thread_ts"`
+	} `json:"message"`
+	ResponseURL string `json:"response_url"`
+	TriggerID   string `json:"trigger_id"`
+	Actions     []struct {
+		ActionID       string `json:"action_id"`
+		BlockID        string `json:"block_id"`
+		Value          string `json:"value"`
+		SelectedOption struct {
+			Value string `json:"value"`
+		} `json:"selected_option"`
+	} `json:"actions"`
+}
+
+func (b *Bot) serveInteraction(w http.ResponseWriter, r *http.Request) {
+	if _, err := verifySlackRequest(b.signingSecret, r); err != nil {
+		b.log.Warningf("Rejecting interaction: %s", err)
+		http.Error(w, "invalid request", http.StatusUnauthorized)
+		return
+	}
+
+	raw := r.PostFormValue("payload")
+	var payload interactionPayload
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		b.log.Errorf("Unable to parse interaction payload: %s", err)
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Type != "block_actions" {
+		b.log.Debugf("Ignoring %s interaction", payload.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	for _, pa := range payload.Actions {
+		a := &Action{
+			ActionID:    pa.ActionID,
+			BlockID:     pa.BlockID,
+			Value:       pa.Value,
+			User:        payload.User.ID,
+			Channel:     payload.Channel.ID,
+			MessageTS:   payload.Message.TS,
+			ThreadTS:    payload.Message.ThreadTS,
+			ResponseURL: payload.ResponseURL,
+			TriggerID:   payload.TriggerID,
+			Raw:         json.RawMessage(raw),
+		}
+		if a.Value == "" {
+			a.Value = pa.SelectedOption.Value
+		}
+
+		h, ok := b.actions[a.ActionID]
+		if !ok {
+			b.log.Warningf("No handler for action %s", a.ActionID)
+			continue
+		}
+
+		b.log.Debugf("Action %s clicked by %s", a.ActionID, a.User)
+		if !b.enqueue(r.Context(), func() { b.serveAction(h, a) }) {
+			http.Error(w, "bot unavailable", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+enqueue queues an invocation to be run by the main loop, giving up if the
+bot stops or ctx is cancelled first. Nothing is queued once the bot has been
+told to stop, since shutdown has already discarded the queue or is about to.
+*/
+func (b *Bot) enqueue(ctx context.Context, invocation func()) bool {
+	select {
+	case <-b.done:
+		return false
+	default:
+	}
+
+	select {
+	case b.commandQueue <- invocation:
+		return true
+	case <-b.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (b *Bot) serveAction(h ActionHandler, a *Action) {
+	if err := h.HandleAction(&actionResponder{bot: b, action: a}, a); err != nil {
+		b.log.Errorf("Error handling action %s: %s", a.ActionID, err)
+	}
+}
+
+// actionResponder is the ActionResponder handed to ActionHandlers.
+type actionResponder struct {
+	bot    *Bot
+	action *Action
+}
+
+func (w *actionResponder) Update(msg *SlackMessage) error {
+	payload := msg.webhookPayload()
+	payload["replace_original"] = true
+	return w.bot.api.postResponseURL(w.bot.ctx, w.action.ResponseURL, payload)
+}
+
+func (w *actionResponder) FollowUp(msg *SlackMessage) error {
+	if msg.Channel == "" {
+		msg.Channel = w.action.Channel
+	}
+	if msg.ThreadTS == "" && msg.Channel == w.action.Channel {
+		msg.ThreadTS = w.action.ThreadTS
+	}
+
+	select {
+	case w.bot.sendQueue <- msg:
+		return nil
+	case <-w.bot.finished:
+		return errBotStopped
+	}
+}
@@ -0,0 +1,99 @@
+package gobot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// approveCommand posts an approval button and handles clicks on it.
+type approveCommand struct {
+	recordCommand
+	clicks chan *Action
+}
+
+func (a approveCommand) ActionIDs() []string { return []string{"approve"} }
+
+func (a approveCommand) HandleAction(w ActionResponder, act *Action) error {
+	a.clicks <- act
+	if err := w.Update(NewSlackMessage("", "Approved by <@"+act.User+">")); err != nil {
+		return err
+	}
+	return w.FollowUp(NewSlackMessage("", "Deploying "+act.Value))
+}
+
+const formContentType = "application/x-www-form-urlencoded"
+
+// signedRequest returns a request to target signed with secret the way Slack signs its requests.
+func signedRequest(t *testing.T, secret, target, contentType, body string) *http.Request {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", signRequest(secret, timestamp, []byte(body)))
+	return r
+}
+
+func TestInteractionDispatch(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(append(slack.options(), WithSigningSecret("shh"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := approveCommand{recordCommand{"deploy", make(chan string, 1)}, make(chan *Action, 1)}
+	b.RegisterCommand(cmd)
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"type":         "block_actions",
+		"user":         map[string]string{"id": "U1"},
+		"channel":      map[string]string{"id": "C1"},
+		"message":      map[string]string{"ts": "1.5", "thread_ts": "1.0"},
+		"response_url": slack.URL + "/api/respond",
+		"actions":      []map[string]string{{"action_id": "approve", "block_id": "b1", "value": "web"}},
+	})
+
+	rec := httptest.NewRecorder()
+	b.InteractionHandler().ServeHTTP(rec, signedRequest(t, "shh", "/slack/interactions", formContentType, url.Values{"payload": {string(payload)}}.Encode()))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	(<-b.commandQueue)()
+
+	act := <-cmd.clicks
+	if act.User != "U1" || act.Channel != "C1" || act.Value != "web" || act.MessageTS != "1.5" {
+		t.Errorf("Unexpected action: %+v", act)
+	}
+
+	call := <-slack.calls
+	var update map[string]interface{}
+	json.Unmarshal(call.body, &update)
+	if call.method != "respond" || update["replace_original"] != true || update["text"] != "Approved by <@U1>" {
+		t.Errorf("Unexpected update: %s %s", call.method, call.body)
+	}
+
+	if msg := <-b.sendQueue; msg.Channel != "C1" || msg.ThreadTS != "1.0" || msg.Text != "Deploying web" {
+		t.Errorf("Unexpected follow up: %s", msg)
+	}
+}
+
+func TestInteractionRejectsBadSignature(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithSigningSecret("shh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	b.InteractionHandler().ServeHTTP(rec, signedRequest(t, "wrong", "/slack/interactions", formContentType, url.Values{"payload": {"{}"}}.Encode()))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", rec.Code)
+	}
+}
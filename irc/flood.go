@@ -0,0 +1,52 @@
+package irc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/*
+floodLimiter spaces out outgoing lines so the server doesn't disconnect the
+bot for flooding. Up to burst lines go out immediately; after that, one line
+is allowed per interval. It works like ircII's penalty timer: every line
+pushes a clock forward by interval, and senders wait while the clock is
+more than burst intervals ahead of now.
+*/
+type floodLimiter struct {
+	burst    int
+	interval time.Duration
+
+	mu    sync.Mutex
+	clock time.Time
+}
+
+/*
+wait blocks until another line may be sent or ctx is done. Callers are
+served in the order they arrive.
+*/
+func (f *floodLimiter) wait(ctx context.Context) error {
+	if f.interval <= 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	if f.clock.Before(now) {
+		f.clock = now
+	}
+
+	window := time.Duration(f.burst-1) * f.interval
+	if ahead := f.clock.Sub(now); ahead > window {
+		select {
+		case <-time.After(ahead - window):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	f.clock = f.clock.Add(f.interval)
+	return nil
+}
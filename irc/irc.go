@@ -0,0 +1,514 @@
+/*
+Package irc connects gobot to an IRC network, so the same commands and
+handlers can serve IRC channels as well as Slack:
+
+	transport, err := irc.New(irc.Config{
+		Server:   "irc.example.com:6697",
+		TLS:      &tls.Config{ServerName: "irc.example.com"},
+		Nick:     "gobot",
+		Channels: []string{"#ops"},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	bot, err := gobot.NewBot(gobot.WithTransport(transport))
+
+The bot is addressed the usual IRC way, by starting a message with its nick
+("gobot: deploy web"). The transport rewrites that into the <@nick> mention
+gobot expects, so the default MentionPrefix addressing works unchanged,
+and turns <@nick> mentions in replies back into plain nicks.
+
+Users are identified by nick. Private messages are received as direct
+messages whose channel is the sender's nick, so replies go back to them.
+*/
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jlindsey/gobot"
+	"github.com/op/go-logging"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultFloodBurst    = 5
+	defaultFloodInterval = 2 * time.Second
+	registerTimeout      = 30 * time.Second
+
+	// readTimeout outlasts the gap between PINGs, which networks send idle clients every few minutes at most.
+	readTimeout = 5 * time.Minute
+)
+
+// mentionPattern matches <@nick> mentions in outgoing text.
+var mentionPattern = regexp.MustCompile(`<@([^>]+)>`)
+
+/*
+Config describes the IRC server to connect to and how to identify to it.
+Server and Nick are required.
+*/
+type Config struct {
+	// Server is the host:port to connect to.
+	Server string
+	// TLS enables TLS with the given configuration; nil connects in plain text.
+	TLS *tls.Config
+	// Password is sent with PASS before registering, for servers that require one.
+	Password string
+
+	// Nick is the bot's nickname. If it's taken, underscores are appended.
+	Nick string
+	// User and RealName default to Nick.
+	User     string
+	RealName string
+
+	// SASLUser and SASLPassword, if set, authenticate with SASL PLAIN during registration.
+	SASLUser     string
+	SASLPassword string
+
+	// Channels are joined once registered.
+	Channels []string
+
+	/*
+		FloodBurst lines may be sent at once, after which one line is sent
+		every FloodInterval. They default to 5 lines and 2 seconds; a negative
+		FloodInterval turns flood protection off.
+	*/
+	FloodBurst    int
+	FloodInterval time.Duration
+
+	// Reconnect controls how dropped connections are retried. Zero fields take the defaults.
+	Reconnect gobot.ReconnectPolicy
+	// Logger receives the transport's logs, including every line sent and received at debug level. It defaults to gobot.Log.
+	Logger *logging.Logger
+}
+
+/*
+Transport is a gobot.Transport for IRC. It also implements
+gobot.DirectMessenger.
+
+If the connection drops, the transport reconnects as Config.Reconnect
+allows, registering again and rejoining Channels. Lines sent while it's
+disconnected fail, and anything said in the meantime is missed. Receive
+returns an error only once the attempts run out.
+*/
+type Transport struct {
+	cfg   Config
+	log   *logging.Logger
+	flood floodLimiter
+
+	// writeMu guards conn as well as writes to it.
+	conn    net.Conn
+	writeMu sync.Mutex
+
+	// nick is the bot's current nick. self is the one it connected with,
+	// which the bot knows itself by even if a reconnect had to pick another.
+	nick string
+	self string
+
+	incoming  chan *gobot.IncomingMessage
+	stopped   chan struct{}
+	err       error
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// New checks cfg and fills in its defaults. The server is dialed and registered with by Connect.
+func New(cfg Config) (*Transport, error) {
+	if cfg.Server == "" {
+		return nil, errors.New("IRC server address is required")
+	}
+	if cfg.Nick == "" {
+		return nil, errors.New("IRC nick is required")
+	}
+	if cfg.User == "" {
+		cfg.User = cfg.Nick
+	}
+	if cfg.RealName == "" {
+		cfg.RealName = cfg.Nick
+	}
+	if cfg.FloodBurst <= 0 {
+		cfg.FloodBurst = defaultFloodBurst
+	}
+	if cfg.FloodInterval == 0 {
+		cfg.FloodInterval = defaultFloodInterval
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = gobot.Log
+	}
+
+	return &Transport{
+		cfg:      cfg,
+		log:      cfg.Logger,
+		flood:    floodLimiter{burst: cfg.FloodBurst, interval: cfg.FloodInterval},
+		incoming: make(chan *gobot.IncomingMessage),
+		stopped:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+/*
+Connect implements gobot.Transport. It dials the server, registers (with
+SASL if configured) and joins the configured channels. The bot's identity
+uses its nick, as accepted by the server, for both ID and Name.
+*/
+func (t *Transport) Connect(ctx context.Context) (*gobot.Identity, error) {
+	conn, reader, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !t.setConn(conn) {
+		conn.Close()
+		return nil, gobot.ErrTransportClosed
+	}
+	t.self = t.nick
+
+	go t.read(conn, reader)
+	return &gobot.Identity{ID: t.self, Name: t.self, Team: t.cfg.Server}, nil
+}
+
+// connect dials the server, registers and joins the configured channels.
+func (t *Transport) connect(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", t.cfg.Server)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Unable to connect to %s: %s", t.cfg.Server, err)
+	}
+	if t.cfg.TLS != nil {
+		tlsConn := tls.Client(conn, t.cfg.TLS)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("TLS handshake with %s failed: %s", t.cfg.Server, err)
+		}
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+
+	deadline := time.Now().Add(registerTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	if err = t.register(conn, reader); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	if len(t.cfg.Channels) > 0 {
+		if err = t.writeTo(conn, "JOIN "+strings.Join(t.cfg.Channels, ",")); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	t.log.Infof("Connected to %s as %s", t.cfg.Server, t.nick)
+	return conn, reader, nil
+}
+
+// setConn makes conn the connection lines are written to, unless the transport has been closed.
+func (t *Transport) setConn(conn net.Conn) bool {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	select {
+	case <-t.closed:
+		return false
+	default:
+	}
+	t.conn = conn
+	return true
+}
+
+// register runs the registration handshake on conn, returning once the server welcomes us.
+func (t *Transport) register(conn net.Conn, reader *bufio.Reader) error {
+	sasl := t.cfg.SASLUser != ""
+	if sasl {
+		if err := t.writeTo(conn, "CAP REQ :sasl"); err != nil {
+			return err
+		}
+	}
+	if t.cfg.Password != "" {
+		if err := t.writeTo(conn, "PASS "+t.cfg.Password); err != nil {
+			return err
+		}
+	}
+
+	t.nick = t.cfg.Nick
+	if err := t.writeTo(conn, "NICK "+t.nick); err != nil {
+		return err
+	}
+	if err := t.writeTo(conn, fmt.Sprintf("USER %s 0 * :%s", t.cfg.User, t.cfg.RealName)); err != nil {
+		return err
+	}
+
+	for {
+		m, err := t.readMessage(reader)
+		if err != nil {
+			return fmt.Errorf("Registration with %s failed: %s", t.cfg.Server, err)
+		}
+
+		switch m.command {
+		case "PING":
+			err = t.writeTo(conn, "PONG :"+m.param(0))
+		case "CAP":
+			switch {
+			case m.param(1) == "ACK" && sasl:
+				err = t.writeTo(conn, "AUTHENTICATE PLAIN")
+			case m.param(1) == "NAK":
+				return errors.New("Server does not support SASL")
+			}
+		case "AUTHENTICATE":
+			if m.param(0) == "+" {
+				creds := t.cfg.SASLUser + "\x00" + t.cfg.SASLUser + "\x00" + t.cfg.SASLPassword
+				err = t.writeTo(conn, "AUTHENTICATE "+base64.StdEncoding.EncodeToString([]byte(creds)))
+			}
+		case "903": // RPL_SASLSUCCESS
+			err = t.writeTo(conn, "CAP END")
+		case "902", "904", "905", "906": // SASL failures
+			return fmt.Errorf("SASL authentication failed: %s", m.param(len(m.params)-1))
+		case "433": // ERR_NICKNAMEINUSE
+			t.nick += "_"
+			err = t.writeTo(conn, "NICK "+t.nick)
+		case "464": // ERR_PASSWDMISMATCH
+			return errors.New("Server password rejected")
+		case "ERROR":
+			return fmt.Errorf("Server closed the connection: %s", m.param(0))
+		case "001": // RPL_WELCOME
+			t.nick = m.param(0)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (t *Transport) readMessage(reader *bufio.Reader) (message, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return message{}, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	t.log.Debugf("IRC <- %s", line)
+	return parseMessage(line), nil
+}
+
+/*
+read serves each connection in turn, reconnecting when one fails, until
+the transport is closed or the reconnect policy gives up.
+*/
+func (t *Transport) read(conn net.Conn, reader *bufio.Reader) {
+	defer close(t.stopped)
+
+	for {
+		err := t.serve(conn, reader)
+		select {
+		case <-t.closed:
+			t.err = gobot.ErrTransportClosed
+			return
+		default:
+		}
+		t.log.Warningf("Lost connection to %s: %s", t.cfg.Server, err)
+
+		if conn, reader, err = t.reconnect(); err != nil {
+			t.err = err
+			return
+		}
+	}
+}
+
+/*
+reconnect connects afresh, retrying as the reconnect policy allows. Dials
+and registrations in progress are abandoned if the transport is closed.
+*/
+func (t *Transport) reconnect() (net.Conn, *bufio.Reader, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-t.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var conn net.Conn
+	var reader *bufio.Reader
+	err := t.cfg.Reconnect.Retry(t.closed, t.log, func(int) (err error) {
+		conn, reader, err = t.connect(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !t.setConn(conn) {
+		conn.Close()
+		return nil, nil, gobot.ErrTransportClosed
+	}
+	return conn, reader, nil
+}
+
+// serve delivers PRIVMSGs to Receive and answers PINGs until conn fails.
+func (t *Transport) serve(conn net.Conn, reader *bufio.Reader) error {
+	for {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+		m, err := t.readMessage(reader)
+		if err != nil {
+			return err
+		}
+
+		switch m.command {
+		case "PING":
+			if err := t.writeTo(conn, "PONG :"+m.param(0)); err != nil {
+				t.log.Errorf("Unable to answer PING: %s", err)
+			}
+		case "NICK":
+			if m.nick() == t.nick {
+				t.nick = m.param(0)
+			}
+		case "PRIVMSG":
+			if msg := t.incomingMessage(m); msg != nil {
+				select {
+				case t.incoming <- msg:
+				case <-t.closed:
+				}
+			}
+		case "ERROR":
+			t.log.Warningf("IRC server error: %s", m.param(0))
+		}
+	}
+}
+
+// incomingMessage converts a PRIVMSG into the message the bot receives, or nil for CTCP requests.
+func (t *Transport) incomingMessage(m message) *gobot.IncomingMessage {
+	target, text := m.param(0), m.param(1)
+	if strings.HasPrefix(text, "\x01") {
+		return nil
+	}
+
+	channel, private := target, !isChannel(target)
+	if private {
+		channel = m.nick()
+	}
+
+	return &gobot.IncomingMessage{
+		Type:          "message",
+		Channel:       channel,
+		User:          m.nick(),
+		Text:          t.mentionsToGobot(text),
+		TS:            fmt.Sprintf("%d", time.Now().UnixNano()),
+		DirectMessage: private,
+	}
+}
+
+/*
+mentionsToGobot rewrites a leading "nick:", "nick," or "@nick" addressed to
+the bot as <@nick>.
+*/
+func (t *Transport) mentionsToGobot(text string) string {
+	nick := t.nick
+	rest := strings.TrimPrefix(text, "@")
+	if len(rest) < len(nick) || !strings.EqualFold(rest[:len(nick)], nick) {
+		return text
+	}
+	after := rest[len(nick):]
+	switch {
+	case after == "":
+	case after[0] == ':' || after[0] == ',':
+		after = after[1:]
+	case after[0] == ' ':
+	default:
+		return text
+	}
+	return "<@" + t.self + ">" + after
+}
+
+// Receive implements gobot.Transport.
+func (t *Transport) Receive(ctx context.Context) (*gobot.IncomingMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.stopped:
+		return nil, t.err
+	case <-t.closed:
+		return nil, gobot.ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+Send implements gobot.Transport. msg's text is sent as one PRIVMSG per
+line, subject to flood protection. Threads, blocks and attachments have no
+IRC equivalent and are ignored.
+*/
+func (t *Transport) Send(ctx context.Context, msg *gobot.SlackMessage) error {
+	text := mentionPattern.ReplaceAllString(msg.Text, "$1")
+	for _, line := range splitText(text) {
+		if err := t.flood.wait(ctx); err != nil {
+			return err
+		}
+		if err := t.writeLine(fmt.Sprintf("PRIVMSG %s :%s", msg.Channel, line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+OpenDM implements gobot.DirectMessenger. Private messages need no setup on
+IRC; they're sent straight to the user's nick.
+*/
+func (t *Transport) OpenDM(ctx context.Context, user string) (string, error) {
+	return user, nil
+}
+
+// Close implements gobot.Transport by quitting the server.
+func (t *Transport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.writeMu.Lock()
+		conn := t.conn
+		t.writeMu.Unlock()
+		if conn == nil {
+			return
+		}
+		t.writeTo(conn, "QUIT :Goodbye")
+		err = conn.Close()
+	})
+	return err
+}
+
+// writeLine writes line to the current connection.
+func (t *Transport) writeLine(line string) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	if t.conn == nil {
+		return errors.New("Not connected to IRC")
+	}
+	return t.write(t.conn, line)
+}
+
+// writeTo writes line to conn, which may not be the current connection yet.
+func (t *Transport) writeTo(conn net.Conn, line string) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return t.write(conn, line)
+}
+
+func (t *Transport) write(conn net.Conn, line string) error {
+	t.log.Debugf("IRC -> %s", line)
+	_, err := io.WriteString(conn, line+"\r\n")
+	return err
+}
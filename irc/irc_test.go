@@ -0,0 +1,482 @@
+package irc
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"github.com/jlindsey/gobot"
+	"github.com/jlindsey/gobot/transporttest"
+	"github.com/op/go-logging"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubServer is a tiny IRC server that accepts a single client and lets the test script the conversation.
+type stubServer struct {
+	t        *testing.T
+	listener net.Listener
+	conn     net.Conn
+	accepted chan struct{}
+	lines    chan string
+}
+
+func newStubServer(t *testing.T, listener net.Listener) *stubServer {
+	if listener == nil {
+		var err error
+		if listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &stubServer{t: t, listener: listener, accepted: make(chan struct{}), lines: make(chan string, 100)}
+	t.Cleanup(func() {
+		listener.Close()
+		select {
+		case <-s.accepted:
+			s.conn.Close()
+		default:
+		}
+	})
+	return s
+}
+
+func (s *stubServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// accept waits for the client to connect and starts collecting the lines it sends.
+func (s *stubServer) accept() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	s.conn = conn
+	close(s.accepted)
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			s.lines <- scanner.Text()
+		}
+		close(s.lines)
+	}()
+}
+
+func (s *stubServer) send(line string) {
+	fmt.Fprintf(s.conn, "%s\r\n", line)
+}
+
+/*
+expect waits for the client to send a line starting with prefix, skipping
+any others. It returns "" if no such line arrives.
+*/
+func (s *stubServer) expect(prefix string) string {
+	s.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				s.t.Errorf("Connection closed while waiting for %q", prefix)
+				return ""
+			}
+			if strings.HasPrefix(line, prefix) {
+				return line
+			}
+		case <-timeout:
+			s.t.Errorf("Timed out waiting for %q", prefix)
+			return ""
+		}
+	}
+}
+
+// register plays the server's side of a plain registration as nick.
+func (s *stubServer) register(nick string) {
+	s.expect("NICK ")
+	s.expect("USER ")
+	s.send(":irc.test 001 " + nick + " :Welcome")
+}
+
+func TestBotOverIRC(t *testing.T) {
+	server := newStubServer(t, nil)
+	transport, err := New(Config{Server: server.addr(), Nick: "gobot", Channels: []string{"#ops", "#dev"}, FloodInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := gobot.NewBot(gobot.WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^echo (.+)$`), "*echo*: Repeats something.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			return w.Reply(fmt.Sprintf("<@%s> said %s", r.User, r.Captures[1]))
+		}))
+
+	go b.Start(context.Background())
+	server.accept()
+	server.expect("USER ")
+	server.send("PING :early")
+	if line := server.expect("PONG"); line != "PONG :early" {
+		t.Errorf("Unexpected PONG during registration: %s", line)
+	}
+	server.send(":irc.test 001 gobot :Welcome")
+	if line := server.expect("JOIN "); line != "JOIN #ops,#dev" {
+		t.Errorf("Unexpected JOIN: %s", line)
+	}
+
+	server.send("PING :irc.test")
+	if line := server.expect("PONG"); line != "PONG :irc.test" {
+		t.Errorf("Unexpected PONG: %s", line)
+	}
+
+	server.send(":alice!a@host PRIVMSG #ops :echo ignored")
+	server.send(":alice!a@host PRIVMSG #ops :\x01VERSION\x01")
+	server.send(":alice!a@host PRIVMSG #ops :GoBot: echo hello")
+	if line := server.expect("PRIVMSG"); line != "PRIVMSG #ops :alice said hello" {
+		t.Errorf("Unexpected channel reply: %s", line)
+	}
+
+	server.send(":bob!b@host PRIVMSG gobot :echo secret")
+	if line := server.expect("PRIVMSG"); line != "PRIVMSG bob :bob said secret" {
+		t.Errorf("Unexpected private reply: %s", line)
+	}
+	server.send(":Dave!d@host PRIVMSG gobot :echo hi")
+	if line := server.expect("PRIVMSG"); line != "PRIVMSG Dave :Dave said hi" {
+		t.Errorf("Unexpected private reply to a nick starting with D: %s", line)
+	}
+
+	b.Stop()
+	if err := b.Wait(); err != nil {
+		t.Errorf("Expected a clean shutdown, got %s", err)
+	}
+	server.expect("QUIT")
+}
+
+func TestConnectWithSASL(t *testing.T) {
+	server := newStubServer(t, nil)
+	transport, err := New(Config{Server: server.addr(), Nick: "gobot", SASLUser: "bot", SASLPassword: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		server.accept()
+		server.expect("CAP REQ :sasl")
+		server.expect("USER ")
+		server.send(":irc.test CAP * ACK :sasl")
+		server.expect("AUTHENTICATE PLAIN")
+		server.send("AUTHENTICATE +")
+		line := server.expect("AUTHENTICATE ")
+		creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTHENTICATE "))
+		if string(creds) != "bot\x00bot\x00hunter2" {
+			t.Errorf("Unexpected SASL credentials %q", creds)
+		}
+		server.send(":irc.test 903 gobot :SASL authentication successful")
+		server.expect("CAP END")
+		server.send(":irc.test 001 gobot :Welcome")
+	}()
+
+	self, err := transport.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	if self.ID != "gobot" || self.Name != "gobot" {
+		t.Errorf("Unexpected identity %+v", self)
+	}
+}
+
+func TestSASLFailure(t *testing.T) {
+	server := newStubServer(t, nil)
+	transport, _ := New(Config{Server: server.addr(), Nick: "gobot", SASLUser: "bot", SASLPassword: "wrong"})
+
+	go func() {
+		server.accept()
+		server.expect("USER ")
+		server.send(":irc.test CAP * ACK :sasl")
+		server.expect("AUTHENTICATE PLAIN")
+		server.send("AUTHENTICATE +")
+		server.expect("AUTHENTICATE ")
+		server.send(":irc.test 904 gobot :SASL authentication failed")
+	}()
+
+	if _, err := transport.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "SASL") {
+		t.Errorf("Expected a SASL error, got %v", err)
+	}
+}
+
+func TestConnectWithTLS(t *testing.T) {
+	// Borrow httptest's self-signed certificate for a TLS listener.
+	certServer := httptest.NewTLSServer(nil)
+	defer certServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newStubServer(t, tls.NewListener(listener, certServer.TLS))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certServer.Certificate())
+	transport, _ := New(Config{Server: server.addr(), Nick: "gobot", TLS: &tls.Config{RootCAs: roots, ServerName: "example.com"}})
+
+	go func() {
+		server.accept()
+		server.register("gobot")
+	}()
+
+	if _, err := transport.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	transport.Close()
+}
+
+func TestNickInUse(t *testing.T) {
+	server := newStubServer(t, nil)
+	transport, _ := New(Config{Server: server.addr(), Nick: "gobot"})
+
+	go func() {
+		server.accept()
+		server.expect("USER ")
+		server.send(":irc.test 433 * gobot :Nickname is already in use")
+		if line := server.expect("NICK "); line != "NICK gobot_" {
+			t.Errorf("Expected an alternative nick, got %s", line)
+		}
+		server.send(":irc.test 001 gobot_ :Welcome")
+		server.send(":alice!a@host PRIVMSG #ops :gobot_, ping")
+	}()
+
+	self, err := transport.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	if self.ID != "gobot_" {
+		t.Errorf("Expected the bot to be known as gobot_, got %s", self.ID)
+	}
+
+	msg, err := transport.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Channel != "#ops" || msg.User != "alice" || msg.Text != "<@gobot_> ping" {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) *transporttest.Fixture {
+		server := newStubServer(t, nil)
+		transport, _ := New(Config{
+			Server:    server.addr(),
+			Nick:      "gobot",
+			Reconnect: gobot.ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		})
+		go func() {
+			server.accept()
+			server.register("gobot")
+		}()
+		if _, err := transport.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		<-server.accepted
+
+		current := server
+		return &transporttest.Fixture{
+			Transport: transport,
+			Deliver: func(text string) {
+				current.send(":alice!a@host PRIVMSG #ops :" + text)
+			},
+			Sent: func() string {
+				line := current.expect("PRIVMSG ")
+				return line[strings.Index(line, " :")+2:]
+			},
+			Drop: func() {
+				current.conn.Close()
+				current = newStubServer(t, server.listener)
+				current.accept()
+				current.register("gobot")
+			},
+		}
+	})
+}
+
+func TestReconnectUnderAnotherNick(t *testing.T) {
+	server := newStubServer(t, nil)
+	transport, _ := New(Config{
+		Server:    server.addr(),
+		Nick:      "gobot",
+		Channels:  []string{"#ops"},
+		Reconnect: gobot.ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxAttempts: 3},
+	})
+
+	registered := make(chan struct{})
+	go func() {
+		server.accept()
+		server.register("gobot")
+		server.expect("JOIN ")
+		close(registered)
+	}()
+	if _, err := transport.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	<-registered
+	server.conn.Close()
+
+	// The nick is still held by the old connection, so the server hands out another.
+	again := newStubServer(t, server.listener)
+	go func() {
+		again.accept()
+		again.register("gobot_")
+		if line := again.expect("JOIN "); line != "JOIN #ops" {
+			t.Errorf("Expected channels to be rejoined, got %s", line)
+		}
+		again.send(":alice!a@host PRIVMSG #ops :gobot_: ping")
+	}()
+
+	msg, err := transport.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "<@gobot> ping" {
+		t.Errorf("Expected mentions of the new nick to address the bot as before, got %q", msg.Text)
+	}
+
+	// Once the server is gone for good, Receive reports it after the last attempt.
+	server.listener.Close()
+	again.conn.Close()
+	if _, err := transport.Receive(context.Background()); err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Expected reconnecting to give up, got %v", err)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	backend := logging.NewMemoryBackend(100)
+	logger := logging.MustGetLogger("irctest")
+	logger.SetBackend(logging.AddModuleLevel(backend))
+
+	server := newStubServer(t, nil)
+	transport, _ := New(Config{Server: server.addr(), Nick: "gobot", Logger: logger})
+	go func() {
+		server.accept()
+		server.register("gobot")
+	}()
+	if _, err := transport.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	transport.Close()
+
+	for node := backend.Head(); node != nil; node = node.Next() {
+		if node.Record.Message() == "IRC -> NICK gobot" {
+			return
+		}
+	}
+	t.Error("Expected the transport to log to the configured logger")
+}
+
+func TestNewFillsInIdentity(t *testing.T) {
+	if _, err := New(Config{Nick: "gobot"}); err == nil {
+		t.Error("Expected an error without a server")
+	}
+	if _, err := New(Config{Server: "irc.test:6667"}); err == nil {
+		t.Error("Expected an error without a nick")
+	}
+
+	transport, err := New(Config{Server: "irc.test:6667", Nick: "gobot", RealName: "Gobot the bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.cfg.User != "gobot" || transport.cfg.RealName != "Gobot the bot" {
+		t.Errorf("Expected User to default to the nick and RealName to be kept, got %q and %q", transport.cfg.User, transport.cfg.RealName)
+	}
+}
+
+func TestMentionsToGobot(t *testing.T) {
+	transport := &Transport{nick: "gobot", self: "gobot"}
+	tests := map[string]string{
+		"gobot: deploy": "<@gobot> deploy",
+		"GoBot, deploy": "<@gobot> deploy",
+		"@gobot deploy": "<@gobot> deploy",
+		"gobot":         "<@gobot>",
+		"gobots rule":   "gobots rule",
+		"hey gobot":     "hey gobot",
+		"gob":           "gob",
+	}
+	for in, want := range tests {
+		if got := transport.mentionsToGobot(in); got != want {
+			t.Errorf("mentionsToGobot(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	tests := map[string]message{
+		"PING :irc.test":                          {command: "PING", params: []string{"irc.test"}},
+		":nick!u@h PRIVMSG #ops :hello there":     {prefix: "nick!u@h", command: "PRIVMSG", params: []string{"#ops", "hello there"}},
+		"@time=2020 :irc.test 001 gobot :Welcome": {prefix: "irc.test", command: "001", params: []string{"gobot", "Welcome"}},
+		":irc.test  cap  *  ACK  :sasl":           {prefix: "irc.test", command: "CAP", params: []string{"*", "ACK", "sasl"}},
+		":irc.test 433 * gobot :Nickname in use ": {prefix: "irc.test", command: "433", params: []string{"*", "gobot", "Nickname in use "}},
+	}
+	for line, want := range tests {
+		if got := parseMessage(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseMessage(%q) = %+v, want %+v", line, got, want)
+		}
+	}
+
+	if m := parseMessage(":nick!u@h PRIVMSG #ops :hi"); m.nick() != "nick" {
+		t.Errorf("Unexpected nick %q", m.nick())
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	if got := splitText("one\r\ntwo\n\nthree"); !reflect.DeepEqual(got, []string{"one", "two", "three"}) {
+		t.Errorf("Unexpected lines %q", got)
+	}
+
+	long := strings.TrimSpace(strings.Repeat("word ", 100))
+	lines := splitText(long)
+	if len(lines) != 2 || strings.Join(lines, " ") != long {
+		t.Errorf("Expected the long line to be split at a space, got %q", lines)
+	}
+
+	runes := splitText(strings.Repeat("é", maxText))
+	for _, line := range runes {
+		if len(line) > maxText || !strings.HasPrefix(line, "é") {
+			t.Errorf("Line split badly: %d bytes", len(line))
+		}
+	}
+	if strings.Join(runes, "") != strings.Repeat("é", maxText) {
+		t.Error("Text was lost while splitting")
+	}
+}
+
+func TestFloodLimiter(t *testing.T) {
+	limiter := floodLimiter{burst: 3, interval: 50 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		limiter.wait(context.Background())
+	}
+	if elapsed := time.Since(start); elapsed > 25*time.Millisecond {
+		t.Errorf("Expected a burst of 3 lines without waiting, took %s", elapsed)
+	}
+
+	limiter.wait(context.Background())
+	limiter.wait(context.Background())
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected lines after the burst to be spaced out, took %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.wait(ctx); err != context.Canceled {
+		t.Errorf("Expected a cancelled wait to fail, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxText bounds the text sent in one PRIVMSG, leaving room for the prefix the server adds within IRC's 512 byte line limit.
+const maxText = 400
+
+// message is a single parsed IRC protocol line.
+type message struct {
+	prefix  string
+	command string
+	params  []string
+}
+
+/*
+parseMessage parses a line of the form
+"[:prefix] COMMAND [params...] [:trailing]" with the CRLF already removed.
+IRCv3 message tags are skipped.
+*/
+func parseMessage(line string) message {
+	var m message
+
+	if strings.HasPrefix(line, "@") {
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			line = strings.TrimLeft(line[i+1:], " ")
+		} else {
+			line = ""
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			m.prefix = line[1:]
+			return m
+		}
+		m.prefix, line = line[1:i], strings.TrimLeft(line[i+1:], " ")
+	}
+
+	for line != "" {
+		if line[0] == ':' {
+			m.params = append(m.params, line[1:])
+			break
+		}
+		i := strings.IndexByte(line, ' ')
+		if i < 0 {
+			i = len(line)
+		}
+		if m.command == "" {
+			m.command = strings.ToUpper(line[:i])
+		} else {
+			m.params = append(m.params, line[:i])
+		}
+		line = strings.TrimLeft(line[i:], " ")
+	}
+	return m
+}
+
+// param returns the i'th parameter, or "" if there aren't that many.
+func (m message) param(i int) string {
+	if i < len(m.params) {
+		return m.params[i]
+	}
+	return ""
+}
+
+// nick returns the nickname part of a "nick!user@host" prefix.
+func (m message) nick() string {
+	if i := strings.IndexByte(m.prefix, '!'); i >= 0 {
+		return m.prefix[:i]
+	}
+	return m.prefix
+}
+
+// isChannel reports whether target names an IRC channel rather than a user.
+func isChannel(target string) bool {
+	return target != "" && strings.ContainsRune("#&+!", rune(target[0]))
+}
+
+/*
+splitText breaks text into lines that each fit in a single PRIVMSG, since
+IRC has no multi-line messages. Long lines are broken at the last space
+before the limit where possible, and never inside a UTF-8 sequence.
+*/
+func splitText(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(text, "\r", "", -1), "\n") {
+		for len(line) > maxText {
+			cut := maxText
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if space := strings.LastIndexByte(line[:cut], ' '); space > 0 {
+				cut = space
+			}
+			lines = append(lines, line[:cut])
+			line = strings.TrimLeft(line[cut:], " ")
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
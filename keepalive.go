@@ -0,0 +1,138 @@
+package gobot
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPingInterval = 30 * time.Second
+	defaultMaxMissed    = 2
+)
+
+/*
+keepalive sends RTM ping frames over a single connection and matches the
+pong replies by ID. If too many pings go unanswered the connection is
+closed, which the reader sees as an error and reports as a disconnect.
+*/
+type keepalive struct {
+	t    *rtmTransport
+	conn *websocket.Conn
+
+	mu      sync.Mutex
+	pending map[uint32]time.Time
+}
+
+/*
+Latency returns the round-trip time of the most recent RTM ping, or zero
+if no ping has been answered yet or the bot isn't using RTM.
+*/
+func (b *Bot) Latency() time.Duration {
+	rtm, ok := b.transport.(*rtmTransport)
+	if !ok {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&rtm.latency))
+}
+
+/*
+startKeepalive starts pinging conn until closed is closed. It also sets a
+read deadline on conn so that a connection which has gone completely silent
+times out even if closing it doesn't unblock the reader. It returns nil if
+keepalive is disabled.
+*/
+func (t *rtmTransport) startKeepalive(conn *websocket.Conn, closed chan struct{}) *keepalive {
+	if t.pingInterval <= 0 {
+		return nil
+	}
+
+	k := &keepalive{t: t, conn: conn, pending: make(map[uint32]time.Time)}
+	k.extendDeadline()
+	go k.run(closed)
+
+	return k
+}
+
+func (k *keepalive) run(closed chan struct{}) {
+	t := k.t
+	ticker := time.NewTicker(t.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if missed := k.missed(); missed >= t.maxMissedPongs {
+				t.log.Warningf("Missed %d pongs from Slack, dropping connection", missed)
+				k.conn.Close()
+				return
+			}
+			if err := k.ping(); err != nil {
+				t.log.Errorf("Unable to send ping: %s", err)
+			}
+		case <-closed:
+			return
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+func (k *keepalive) ping() error {
+	t := k.t
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	id := t.nextMessageID()
+	str, err := json.Marshal(map[string]interface{}{
+		"id":   id,
+		"type": "ping",
+	})
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.pending[id] = time.Now()
+	k.mu.Unlock()
+
+	return k.conn.WriteMessage(websocket.TextMessage, str)
+}
+
+/*
+pong records the reply to the ping with the given ID. Any older pings still
+pending are forgotten, since a newer reply proves the connection is alive.
+*/
+func (k *keepalive) pong(replyTo uint32) {
+	k.mu.Lock()
+	sent, ok := k.pending[replyTo]
+	for id := range k.pending {
+		if id <= replyTo {
+			delete(k.pending, id)
+		}
+	}
+	k.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	rtt := time.Since(sent)
+	atomic.StoreInt64(&k.t.latency, int64(rtt))
+	k.t.log.Debugf("Pong %d from Slack after %s", replyTo, rtt)
+}
+
+func (k *keepalive) missed() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.pending)
+}
+
+// extendDeadline pushes the read deadline out after any incoming frame.
+func (k *keepalive) extendDeadline() {
+	t := k.t
+	k.conn.SetReadDeadline(time.Now().Add(t.pingInterval * time.Duration(t.maxMissedPongs+1)))
+}
@@ -0,0 +1,71 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"testing"
+	"time"
+)
+
+func TestKeepaliveMeasuresLatency(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(append(slack.options(), WithKeepalive(10*time.Millisecond, 2))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.Start(context.Background())
+	defer b.Stop()
+
+	server := <-slack.conns
+	defer server.Close()
+
+	var ping struct {
+		ID   uint32 `json:"id"`
+		Type string `json:"type"`
+	}
+	if err = server.ReadJSON(&ping); err != nil {
+		t.Fatal(err)
+	}
+	if ping.Type != "ping" {
+		t.Fatalf("Expected a ping, got %+v", ping)
+	}
+
+	time.Sleep(time.Millisecond)
+	pong, _ := json.Marshal(map[string]interface{}{"type": "pong", "reply_to": ping.ID})
+	server.WriteMessage(websocket.TextMessage, pong)
+
+	for deadline := time.Now().Add(time.Second); b.Latency() == 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Latency was never recorded")
+		}
+	}
+	if b.Latency() < time.Millisecond {
+		t.Errorf("Expected latency of at least 1ms, got %s", b.Latency())
+	}
+}
+
+func TestKeepaliveReconnectsAfterMissedPongs(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(append(slack.options(),
+		WithKeepalive(10*time.Millisecond, 2),
+		WithReconnectPolicy(ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}),
+	)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go b.Start(context.Background())
+	defer b.Stop()
+
+	first := <-slack.conns
+	defer first.Close()
+
+	select {
+	case second := <-slack.conns:
+		second.Close()
+	case <-time.After(time.Second):
+		t.Fatal("Expected the bot to reconnect after pongs went missing")
+	}
+}
@@ -0,0 +1,107 @@
+package gobot
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+/*
+Listener is a Handler that passively watches every message in the channels
+the bot is in, rather than only messages addressed to it. Listeners are
+registered with RegisterListener and are useful for things like expanding
+ticket IDs into links or reacting to keywords.
+
+Listeners never fire on the bot's own messages.
+*/
+type Listener struct {
+	route *Route
+	every time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+/*
+RegisterListener adds a Listener that runs h whenever a message's full
+text matches pattern. Unlike RegisterHandler, the bot does not need to be
+mentioned, and the text is not stripped of any mention. Listeners only see
+channel messages unless widened with Listener.In.
+
+Listeners are separate from the command registry: a message may trigger
+any number of listeners as well as one command.
+*/
+func (b *Bot) RegisterListener(pattern *regexp.Regexp, h Handler) *Listener {
+	b.log.Debugf("Registering listener: %s", pattern)
+	l := &Listener{
+		route: &Route{
+			name:    fmt.Sprintf("Listener{pattern: %s}", pattern),
+			pattern: pattern,
+			match:   pattern.FindStringSubmatch,
+			handler: h,
+			scope:   InChannels,
+		},
+		last: make(map[string]time.Time),
+	}
+	b.listeners = append(b.listeners, l)
+	return l
+}
+
+// String implements the Stringer interface.
+func (l *Listener) String() string {
+	return l.route.String()
+}
+
+// In restricts the listener to the given scope and returns it for chaining.
+func (l *Listener) In(s Scope) *Listener {
+	l.route.In(s)
+	return l
+}
+
+/*
+RateLimit stops the listener firing more than once per interval in any
+one channel and returns it for chaining. Matches within the interval are
+dropped.
+*/
+func (l *Listener) RateLimit(every time.Duration) *Listener {
+	l.every = every
+	return l
+}
+
+// allow reports whether the listener may fire in channel now, and records it if so.
+func (l *Listener) allow(channel string, now time.Time) bool {
+	if l.every <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last, ok := l.last[channel]; ok && now.Sub(last) < l.every {
+		return false
+	}
+	l.last[channel] = now
+	return true
+}
+
+// dispatchListeners queues every listener that matches msg.
+func (b *Bot) dispatchListeners(msg *IncomingMessage, dm bool) {
+	for _, l := range b.listeners {
+		if !l.route.scope.allows(dm) {
+			continue
+		}
+
+		captures := l.route.match(msg.Text)
+		if captures == nil || !l.allow(msg.Channel, time.Now()) {
+			continue
+		}
+
+		b.log.Debugf("%s Triggered by %s", l, msg.Text)
+		rt := l.route
+		if !b.enqueue(b.ctx, func() { b.serve(rt, msg, captures) }) {
+			b.log.Warningf("Not running %s, shutting down", l)
+			return
+		}
+	}
+}
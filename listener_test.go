@@ -0,0 +1,56 @@
+package gobot
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func recordingListener(b *Bot, pattern string) (*Listener, chan *Request) {
+	reqs := make(chan *Request, 10)
+	l := b.RegisterListener(regexp.MustCompile(pattern), HandlerFunc(func(w ResponseWriter, r *Request) error {
+		reqs <- r
+		return nil
+	}))
+	return l, reqs
+}
+
+func TestListenerSeesUnaddressedMessages(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	_, reqs := recordingListener(b, `[A-Z]+-\d+`)
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "text": "see ABC-123 please"}`)
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "text": "nothing here"}`)
+
+	if len(reqs) != 1 {
+		t.Fatalf("Expected 1 listener run, got %d", len(reqs))
+	}
+	if r := <-reqs; r.Captures[0] != "ABC-123" || r.Text != "see ABC-123 please" {
+		t.Errorf("Unexpected request: %+v", r)
+	}
+}
+
+func TestListenerIgnoresOwnMessages(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	_, reqs := recordingListener(b, `ABC-\d+`)
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U0BOT", "text": "ABC-123 is https://example.com/ABC-123"}`)
+
+	if len(reqs) != 0 {
+		t.Error("Expected the listener to ignore the bot's own message")
+	}
+}
+
+func TestListenerRateLimit(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	l, reqs := recordingListener(b, `deploy`)
+	l.RateLimit(time.Hour)
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "text": "deploy"}`)
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "text": "deploy"}`)
+	dispatch(t, b, `{"type": "message", "channel": "C2", "user": "U1", "text": "deploy"}`)
+
+	if len(reqs) != 2 {
+		t.Errorf("Expected one run per channel, got %d", len(reqs))
+	}
+}
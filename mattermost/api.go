@@ -0,0 +1,101 @@
+package mattermost
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jlindsey/gobot"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// user is the part of a Mattermost user object the transport needs.
+type user struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// post is the part of a Mattermost post object the transport reads and writes.
+type post struct {
+	ID        string                 `json:"id,omitempty"`
+	UserID    string                 `json:"user_id,omitempty"`
+	ChannelID string                 `json:"channel_id"`
+	RootID    string                 `json:"root_id,omitempty"`
+	Message   string                 `json:"message"`
+	Type      string                 `json:"type,omitempty"`
+	Props     map[string]interface{} `json:"props,omitempty"`
+}
+
+// apiError is the body of a failed Mattermost API call.
+type apiError struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+/*
+call makes a REST API call authenticated with the access token, sending in
+as the JSON body if it isn't nil and decoding the response into out if it
+isn't nil. Failures are returned as *gobot.HTTPError, with Mattermost's
+error message as the cause where it gave one.
+*/
+func (t *Transport) call(ctx context.Context, method, path string, in, out interface{}) error {
+	endpoint := t.baseURL + "/api/v4" + path
+
+	var body io.Reader
+	if in != nil {
+		encoded, err := json.Marshal(in)
+		if err != nil {
+			return &gobot.HTTPError{Endpoint: endpoint, Err: err}
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return &gobot.HTTPError{Endpoint: endpoint, Err: err}
+	}
+	req.Header.Set("Authorization", "Bearer "+t.cfg.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := t.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return &gobot.HTTPError{Endpoint: endpoint, Err: err}
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return &gobot.HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Err: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		httpErr := &gobot.HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+		var failure apiError
+		if json.Unmarshal(respBody, &failure) == nil && failure.Message != "" {
+			httpErr.Err = errors.New(failure.Message)
+		}
+		return httpErr
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return &gobot.HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Err: err}
+		}
+	}
+	return nil
+}
+
+func (t *Transport) getUser(ctx context.Context, id string) (*user, error) {
+	var u user
+	if err := t.call(ctx, "GET", "/users/"+id, nil, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (t *Transport) createPost(ctx context.Context, p *post) error {
+	return t.call(ctx, "POST", "/posts", p, nil)
+}
@@ -0,0 +1,436 @@
+/*
+Package mattermost connects gobot to a Mattermost server, so the same
+commands and handlers can serve Mattermost teams as well as Slack:
+
+	transport, err := mattermost.New(mattermost.Config{
+		URL:   "https://chat.example.com",
+		Token: os.Getenv("MATTERMOST_TOKEN"),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	bot, err := gobot.NewBot(gobot.WithTransport(transport))
+
+The bot authenticates with a personal access token (or a bot account's
+token), receives posts over the websocket event API and replies through the
+REST posts API. Users and channels are identified by their Mattermost IDs.
+
+Mattermost mentions look like "@gobot"; the transport rewrites mentions of
+the bot into the <@id> form gobot expects, so the default MentionPrefix
+addressing works unchanged, and turns <@id> mentions in replies into
+@username mentions. Posts in direct message channels are received as
+direct messages.
+*/
+package mattermost
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/jlindsey/gobot"
+	"github.com/op/go-logging"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// readTimeout allows for a missed websocket ping from Mattermost, which sends one about once a minute.
+	readTimeout           = 2 * time.Minute
+	closeHandshakeTimeout = time.Second
+	defaultHTTPTimeout    = 30 * time.Second
+)
+
+// mentionPattern matches <@id> mentions in outgoing text.
+var mentionPattern = regexp.MustCompile(`<@([a-z0-9]+)>`)
+
+/*
+Config describes the Mattermost server to connect to. URL and Token are
+required.
+*/
+type Config struct {
+	// URL is the server's address, eg. "https://chat.example.com".
+	URL string
+	// Token is a personal access token or bot account token.
+	Token string
+	// TLS configures TLS for both the REST API and the websocket, eg. to trust an internal CA.
+	TLS *tls.Config
+	// HTTPClient makes REST API calls. It defaults to a client with a 30 second timeout using TLS.
+	HTTPClient *http.Client
+
+	// Reconnect controls how a dropped websocket is redialed. Zero fields take the defaults.
+	Reconnect gobot.ReconnectPolicy
+	// Logger receives the transport's logs, such as websocket drops and events it couldn't parse. It defaults to gobot.Log.
+	Logger *logging.Logger
+}
+
+// wsEvent is a single event received over the Mattermost websocket.
+type wsEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+/*
+Transport is a gobot.Transport for Mattermost. It also implements
+gobot.Reactor and gobot.DirectMessenger.
+
+If the websocket drops, the transport redials it as Config.Reconnect
+allows. Posts made while it's down aren't received, but replies can still
+be sent, since they go through the REST API. Receive returns an error only
+once the attempts run out.
+*/
+type Transport struct {
+	cfg     Config
+	log     *logging.Logger
+	baseURL string
+	dialer  *websocket.Dialer
+
+	self      user
+	selfMatch *regexp.Regexp
+	usersMu   sync.Mutex
+	usernames map[string]string
+
+	// writeMu guards conn as well as writes to it.
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	incoming  chan *gobot.IncomingMessage
+	stopped   chan struct{}
+	err       error
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+/*
+New checks that cfg has a token and an http or https URL. The token isn't
+tried until Connect looks up the bot's own user.
+*/
+func New(cfg Config) (*Transport, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("Mattermost access token is required")
+	}
+	base, err := url.Parse(strings.TrimRight(cfg.URL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf(`Mattermost URL must be an http or https URL, not "%s"`, cfg.URL)
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{
+			Timeout:   defaultHTTPTimeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: cfg.TLS},
+		}
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = gobot.Log
+	}
+
+	return &Transport{
+		cfg:       cfg,
+		log:       cfg.Logger,
+		baseURL:   base.String(),
+		dialer:    &websocket.Dialer{Proxy: http.ProxyFromEnvironment, TLSClientConfig: cfg.TLS, HandshakeTimeout: defaultHTTPTimeout},
+		usernames: make(map[string]string),
+		incoming:  make(chan *gobot.IncomingMessage),
+		stopped:   make(chan struct{}),
+		closed:    make(chan struct{}),
+	}, nil
+}
+
+/*
+Connect implements gobot.Transport. It looks up the token's user, which
+becomes the bot's identity, and opens the websocket.
+*/
+func (t *Transport) Connect(ctx context.Context) (*gobot.Identity, error) {
+	if err := t.call(ctx, "GET", "/users/me", nil, &t.self); err != nil {
+		return nil, err
+	}
+	t.rememberUser(t.self.ID, t.self.Username)
+	t.selfMatch = regexp.MustCompile(`(?i)(^|[^\w@.-])@` + regexp.QuoteMeta(t.self.Username) + `([^\w-]|$)`)
+
+	conn, err := t.dial()
+	if err != nil {
+		return nil, err
+	}
+	if !t.setConn(conn) {
+		conn.Close()
+		return nil, gobot.ErrTransportClosed
+	}
+	t.log.Infof("Connected to %s as %s", t.baseURL, t.self.Username)
+
+	go t.read(conn)
+
+	host, _ := url.Parse(t.baseURL)
+	return &gobot.Identity{ID: t.self.ID, Name: t.self.Username, Team: host.Host}, nil
+}
+
+// dial opens the websocket the server sends events over.
+func (t *Transport) dial() (*websocket.Conn, error) {
+	socketURL := "ws" + strings.TrimPrefix(t.baseURL, "http") + "/api/v4/websocket"
+	header := http.Header{"Authorization": []string{"Bearer " + t.cfg.Token}}
+	conn, _, err := t.dialer.Dial(socketURL, header)
+	if err != nil {
+		return nil, &gobot.DialError{URL: socketURL, Err: err}
+	}
+	return conn, nil
+}
+
+// setConn makes conn the websocket control frames are written to, unless the transport has been closed.
+func (t *Transport) setConn(conn *websocket.Conn) bool {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	select {
+	case <-t.closed:
+		return false
+	default:
+	}
+	t.conn = conn
+	return true
+}
+
+/*
+read serves each websocket in turn, redialing when one fails, until the
+transport is closed or the reconnect policy gives up.
+*/
+func (t *Transport) read(conn *websocket.Conn) {
+	defer close(t.stopped)
+
+	for {
+		err := t.serve(conn)
+		select {
+		case <-t.closed:
+			t.err = gobot.ErrTransportClosed
+			return
+		default:
+		}
+		t.log.Warningf("Lost Mattermost websocket: %s", err)
+
+		if conn, err = t.reconnect(); err != nil {
+			t.err = err
+			return
+		}
+	}
+}
+
+// reconnect redials the websocket, retrying as the reconnect policy allows.
+func (t *Transport) reconnect() (*websocket.Conn, error) {
+	var conn *websocket.Conn
+	err := t.cfg.Reconnect.Retry(t.closed, t.log, func(int) (err error) {
+		conn, err = t.dial()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !t.setConn(conn) {
+		conn.Close()
+		return nil, gobot.ErrTransportClosed
+	}
+	t.log.Infof("Reconnected to %s", t.baseURL)
+	return conn, nil
+}
+
+// serve delivers posts from conn to Receive until it fails.
+func (t *Transport) serve(conn *websocket.Conn) error {
+	extendDeadline := func() {
+		conn.SetReadDeadline(time.Now().Add(readTimeout))
+	}
+	extendDeadline()
+	conn.SetPingHandler(func(data string) error {
+		extendDeadline()
+		t.writeMu.Lock()
+		defer t.writeMu.Unlock()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		extendDeadline()
+		t.log.Debugf("Raw incoming Mattermost event: %s", raw)
+
+		var event wsEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			t.log.Errorf("Error parsing Mattermost event: %s", err)
+			continue
+		}
+		if event.Event != "posted" {
+			continue
+		}
+
+		msg, err := t.incomingMessage(event.Data)
+		if err != nil {
+			t.log.Errorf("Unable to parse Mattermost post: %s", err)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+		select {
+		case t.incoming <- msg:
+		case <-t.closed:
+		}
+	}
+}
+
+/*
+incomingMessage converts the data of a "posted" event into the message the
+bot receives, or nil for system messages such as channel joins.
+*/
+func (t *Transport) incomingMessage(raw json.RawMessage) (*gobot.IncomingMessage, error) {
+	var data struct {
+		ChannelType string `json:"channel_type"`
+		Post        string `json:"post"`
+		SenderName  string `json:"sender_name"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	// The post is itself JSON, encoded as a string.
+	var p post
+	if err := json.Unmarshal([]byte(data.Post), &p); err != nil {
+		return nil, err
+	}
+	if p.Type != "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(data.SenderName, "@") {
+		t.rememberUser(p.UserID, strings.TrimPrefix(data.SenderName, "@"))
+	}
+
+	return &gobot.IncomingMessage{
+		Type:          "message",
+		Channel:       p.ChannelID,
+		User:          p.UserID,
+		Text:          t.selfMatch.ReplaceAllString(p.Message, "${1}<@"+t.self.ID+">${2}"),
+		TS:            p.ID,
+		ThreadTS:      p.RootID,
+		DirectMessage: data.ChannelType == "D",
+		Raw:           raw,
+	}, nil
+}
+
+// Receive implements gobot.Transport.
+func (t *Transport) Receive(ctx context.Context) (*gobot.IncomingMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.stopped:
+		return nil, t.err
+	case <-t.closed:
+		return nil, gobot.ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+Send implements gobot.Transport by creating a post. Threaded replies become
+replies to the thread's root post, and attachments are passed through as
+Mattermost's Slack-compatible message attachments. Blocks are ignored.
+*/
+func (t *Transport) Send(ctx context.Context, msg *gobot.SlackMessage) error {
+	p := &post{
+		ChannelID: msg.Channel,
+		RootID:    msg.ThreadTS,
+		Message:   t.mentionsToMattermost(ctx, msg.Text),
+	}
+	if len(msg.Attachments) > 0 {
+		p.Props = map[string]interface{}{"attachments": msg.Attachments}
+	}
+	return t.createPost(ctx, p)
+}
+
+// mentionsToMattermost turns <@id> mentions into @username, looking up users it hasn't seen.
+func (t *Transport) mentionsToMattermost(ctx context.Context, text string) string {
+	return mentionPattern.ReplaceAllStringFunc(text, func(mention string) string {
+		id := mentionPattern.FindStringSubmatch(mention)[1]
+		name, err := t.username(ctx, id)
+		if err != nil {
+			t.log.Warningf("Unable to look up Mattermost user %s: %s", id, err)
+			return mention
+		}
+		return "@" + name
+	})
+}
+
+func (t *Transport) username(ctx context.Context, id string) (string, error) {
+	t.usersMu.Lock()
+	name, ok := t.usernames[id]
+	t.usersMu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	u, err := t.getUser(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	t.rememberUser(u.ID, u.Username)
+	return u.Username, nil
+}
+
+func (t *Transport) rememberUser(id, username string) {
+	t.usersMu.Lock()
+	defer t.usersMu.Unlock()
+	t.usernames[id] = username
+}
+
+// React implements gobot.Reactor. ts is the ID of the post to react to.
+func (t *Transport) React(ctx context.Context, channel, ts, emoji string) error {
+	reaction := map[string]string{
+		"user_id":    t.self.ID,
+		"post_id":    ts,
+		"emoji_name": strings.Trim(emoji, ":"),
+	}
+	return t.call(ctx, "POST", "/reactions", reaction, nil)
+}
+
+// OpenDM implements gobot.DirectMessenger by creating (or finding) the direct message channel with user.
+func (t *Transport) OpenDM(ctx context.Context, userID string) (string, error) {
+	var channel struct {
+		ID string `json:"id"`
+	}
+	if err := t.call(ctx, "POST", "/channels/direct", []string{t.self.ID, userID}, &channel); err != nil {
+		return "", err
+	}
+	return channel.ID, nil
+}
+
+// Close implements gobot.Transport by closing the websocket.
+func (t *Transport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.writeMu.Lock()
+		conn := t.conn
+		if conn != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeHandshakeTimeout))
+		}
+		t.writeMu.Unlock()
+		if conn == nil {
+			return
+		}
+
+		select {
+		case <-t.stopped:
+		case <-time.After(closeHandshakeTimeout):
+		}
+		err = conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,317 @@
+package mattermost
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/jlindsey/gobot"
+	"github.com/jlindsey/gobot/transporttest"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeServer is a Mattermost server with just enough of the REST and websocket APIs for the transport.
+type fakeServer struct {
+	*httptest.Server
+	t       *testing.T
+	sockets chan *websocket.Conn
+	posts   chan post
+	calls   chan string
+
+	// refuseSockets makes the websocket endpoint fail, as it would while the server restarts.
+	refuseSockets int32
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	s := &fakeServer{t: t, sockets: make(chan *websocket.Conn, 1), posts: make(chan post, 10), calls: make(chan string, 10)}
+	users := map[string]string{"botid": "gobot", "aliceid": "alice", "bobid": "bob"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v4/users/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/api/v4/users/")
+		if id == "me" {
+			id = "botid"
+		}
+		if users[id] == "" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"id": "app.user.missing_account.const", "message": "Unable to find the user."}`)
+			return
+		}
+		json.NewEncoder(w).Encode(user{ID: id, Username: users[id]})
+	})
+	mux.HandleFunc("/api/v4/posts", func(w http.ResponseWriter, r *http.Request) {
+		var p post
+		json.NewDecoder(r.Body).Decode(&p)
+		s.posts <- p
+		fmt.Fprint(w, `{"id": "newpost"}`)
+	})
+	mux.HandleFunc("/api/v4/reactions", func(w http.ResponseWriter, r *http.Request) {
+		var reaction map[string]string
+		json.NewDecoder(r.Body).Decode(&reaction)
+		s.calls <- fmt.Sprintf("react %s %s %s", reaction["user_id"], reaction["post_id"], reaction["emoji_name"])
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/api/v4/channels/direct", func(w http.ResponseWriter, r *http.Request) {
+		var members []string
+		json.NewDecoder(r.Body).Decode(&members)
+		s.calls <- "direct " + strings.Join(members, ",")
+		fmt.Fprint(w, `{"id": "dmchan"}`)
+	})
+	mux.HandleFunc("/api/v4/websocket", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&s.refuseSockets) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// Reading lets the connection answer the client's close handshake.
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+		s.sockets <- conn
+	})
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"id": "api.context.session_expired.app_error", "message": "Invalid or expired session."}`)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// posted sends a "posted" event for a post by userID in a channel of the given type.
+func posted(conn *websocket.Conn, channelType string, p post, sender string) {
+	encoded, _ := json.Marshal(p)
+	data, _ := json.Marshal(map[string]string{"channel_type": channelType, "post": string(encoded), "sender_name": "@" + sender})
+	conn.WriteJSON(map[string]interface{}{"event": "posted", "data": json.RawMessage(data), "seq": 1})
+}
+
+func (s *fakeServer) nextPost() post {
+	s.t.Helper()
+	select {
+	case p := <-s.posts:
+		return p
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("Timed out waiting for a post")
+		return post{}
+	}
+}
+
+func (s *fakeServer) nextCall() string {
+	s.t.Helper()
+	select {
+	case call := <-s.calls:
+		return call
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("Timed out waiting for an API call")
+		return ""
+	}
+}
+
+func TestBotOverMattermost(t *testing.T) {
+	server := newFakeServer(t)
+	transport, err := New(Config{URL: server.URL + "/", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := gobot.NewBot(gobot.WithTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^echo (.+)$`), "*echo*: Repeats something.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			return w.Reply(fmt.Sprintf("<@%s> said %s", r.User, r.Captures[1]))
+		}))
+	b.RegisterHandler(regexp.MustCompile(`^whisper (.+)$`), "*whisper*: Repeats something privately.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			w.React("thumbsup")
+			return w.DM(r.User, r.Captures[1])
+		}))
+
+	go b.Start(context.Background())
+	conn := <-server.sockets
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]interface{}{"event": "hello", "data": map[string]string{"server_version": "9.0.0"}, "seq": 0})
+	posted(conn, "O", post{ID: "p0", UserID: "aliceid", ChannelID: "town", Message: "echo unaddressed"}, "alice")
+	posted(conn, "O", post{ID: "p1", UserID: "aliceid", ChannelID: "town", Message: "alice joined", Type: "system_join_channel"}, "alice")
+	posted(conn, "O", post{ID: "p2", UserID: "aliceid", ChannelID: "town", RootID: "p0", Message: "@GoBot echo hi <@bobid>"}, "alice")
+	if p := server.nextPost(); p.ChannelID != "town" || p.RootID != "p0" || p.Message != "@alice said hi @bob" {
+		t.Errorf("Unexpected reply %+v", p)
+	}
+
+	posted(conn, "D", post{ID: "p3", UserID: "bobid", ChannelID: "bobdm", Message: "echo secret"}, "bob")
+	if p := server.nextPost(); p.ChannelID != "bobdm" || p.Message != "@bob said secret" {
+		t.Errorf("Unexpected DM reply %+v", p)
+	}
+
+	posted(conn, "O", post{ID: "p4", UserID: "aliceid", ChannelID: "town", Message: "@gobot: whisper psst"}, "alice")
+	if call := server.nextCall(); call != "react botid p4 thumbsup" {
+		t.Errorf("Unexpected reaction: %s", call)
+	}
+	if call := server.nextCall(); call != "direct botid,aliceid" {
+		t.Errorf("Unexpected DM channel request: %s", call)
+	}
+	if p := server.nextPost(); p.ChannelID != "dmchan" || p.Message != "psst" {
+		t.Errorf("Unexpected DM %+v", p)
+	}
+
+	b.Stop()
+	if err := b.Wait(); err != nil {
+		t.Errorf("Expected a clean shutdown, got %s", err)
+	}
+}
+
+func TestSendAttachments(t *testing.T) {
+	server := newFakeServer(t)
+	transport, _ := New(Config{URL: server.URL, Token: "token"})
+	msg := gobot.NewSlackMessage("town", "Deployed <@unknownid>")
+	msg.Attachments = []gobot.Attachment{{Title: "web", Color: "good"}}
+
+	if err := transport.Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	p := server.nextPost()
+	if p.Message != "Deployed <@unknownid>" {
+		t.Errorf("Expected unknown mentions to be left alone, got %q", p.Message)
+	}
+	attachments, _ := json.Marshal(p.Props["attachments"])
+	if string(attachments) != `[{"color":"good","title":"web"}]` {
+		t.Errorf("Unexpected attachments %s", attachments)
+	}
+}
+
+func TestConnectWithBadToken(t *testing.T) {
+	server := newFakeServer(t)
+	transport, _ := New(Config{URL: server.URL, Token: "expired"})
+
+	_, err := transport.Connect(context.Background())
+	httpErr, ok := err.(*gobot.HTTPError)
+	if !ok || httpErr.StatusCode != http.StatusUnauthorized || !strings.Contains(err.Error(), "Invalid or expired session") {
+		t.Errorf("Expected an HTTPError with Mattermost's message, got %v", err)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) *transporttest.Fixture {
+		server := newFakeServer(t)
+		transport, _ := New(Config{
+			URL:       server.URL,
+			Token:     "token",
+			Reconnect: gobot.ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		})
+		if _, err := transport.Connect(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		conn := <-server.sockets
+		return &transporttest.Fixture{
+			Transport: transport,
+			Deliver: func(text string) {
+				posted(conn, "O", post{ID: "p1", UserID: "aliceid", ChannelID: "town", Message: text}, "alice")
+			},
+			Sent: func() string { return (<-server.posts).Message },
+			Drop: func() {
+				conn.Close()
+				conn = <-server.sockets
+			},
+		}
+	})
+}
+
+func TestSendWhileWebsocketIsDown(t *testing.T) {
+	server := newFakeServer(t)
+	transport, _ := New(Config{
+		URL:       server.URL,
+		Token:     "token",
+		Reconnect: gobot.ReconnectPolicy{MinBackoff: 50 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, MaxAttempts: 3},
+	})
+	if _, err := transport.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	atomic.StoreInt32(&server.refuseSockets, 1)
+	(<-server.sockets).Close()
+
+	// Replies go through the REST API, so they don't wait for the websocket.
+	if err := transport.Send(context.Background(), gobot.NewSlackMessage("town", "still up")); err != nil {
+		t.Errorf("Expected to post while the websocket is down, got %s", err)
+	}
+	if p := server.nextPost(); p.Message != "still up" {
+		t.Errorf("Unexpected post %+v", p)
+	}
+
+	if _, err := transport.Receive(context.Background()); err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Expected reconnecting to give up, got %v", err)
+	}
+}
+
+func TestNewRejectsBadURLs(t *testing.T) {
+	if _, err := New(Config{URL: "https://chat.example.com"}); err == nil {
+		t.Error("Expected an error without a token")
+	}
+	for _, bad := range []string{"", "chat.example.com", "ftp://chat.example.com", "https://"} {
+		if _, err := New(Config{URL: bad, Token: "token"}); err == nil {
+			t.Errorf("Expected an error for URL %q", bad)
+		}
+	}
+
+	transport, err := New(Config{URL: "https://chat.example.com/", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.baseURL != "https://chat.example.com" {
+		t.Errorf("Expected the trailing slash to be dropped, got %s", transport.baseURL)
+	}
+}
+
+func TestMentionsOfBot(t *testing.T) {
+	server := newFakeServer(t)
+	transport, _ := New(Config{URL: server.URL, Token: "token"})
+	if _, err := transport.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+	conn := <-server.sockets
+
+	tests := map[string]string{
+		"@gobot deploy":        "<@botid> deploy",
+		"@gobot: deploy":       "<@botid>: deploy",
+		"thanks @gobot!":       "thanks <@botid>!",
+		"@gobotnik deploy":     "@gobotnik deploy",
+		"@gobot-dev deploy":    "@gobot-dev deploy",
+		"mail me@gobot please": "mail me@gobot please",
+	}
+	for in, want := range tests {
+		posted(conn, "O", post{ID: "p1", UserID: "aliceid", ChannelID: "town", Message: in}, "alice")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		msg, err := transport.Receive(ctx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Text != want {
+			t.Errorf("Mention in %q became %q, want %q", in, msg.Text, want)
+		}
+	}
+}
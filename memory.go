@@ -0,0 +1,106 @@
+package gobot
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+MemoryTransport is a Transport that lives entirely in memory, for testing
+commands and handlers without a chat service. Messages passed to Deliver
+are received by the bot as if a user had sent them, and everything the bot
+sends can be read from Sent.
+
+	transport := gobot.NewMemoryTransport(gobot.Identity{ID: "U0BOT", Name: "gobot"})
+	bot, _ := gobot.NewBot(gobot.WithTransport(transport))
+	bot.RegisterCommand(myCommand)
+	go bot.Start(ctx)
+
+	transport.Deliver(&gobot.IncomingMessage{Type: "message", Channel: "C1", User: "U1", Text: "<@U0BOT> ping"})
+	reply := <-transport.Sent()
+
+Set DirectMessage on delivered messages to have them treated as DMs. Direct
+message channels opened through MemoryTransport are named "D" followed by
+the user's ID.
+*/
+type MemoryTransport struct {
+	identity Identity
+	incoming chan *IncomingMessage
+	sent     chan *SlackMessage
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+/*
+NewMemoryTransport returns a MemoryTransport that identifies the bot as self.
+Up to 100 sent messages are buffered for Sent; beyond that, the bot's sends
+block until they are read.
+*/
+func NewMemoryTransport(self Identity) *MemoryTransport {
+	return &MemoryTransport{
+		identity: self,
+		incoming: make(chan *IncomingMessage),
+		sent:     make(chan *SlackMessage, 100),
+		closed:   make(chan struct{}),
+	}
+}
+
+// Connect implements Transport.
+func (t *MemoryTransport) Connect(ctx context.Context) (*Identity, error) {
+	self := t.identity
+	return &self, nil
+}
+
+// Receive implements Transport.
+func (t *MemoryTransport) Receive(ctx context.Context) (*IncomingMessage, error) {
+	select {
+	case msg := <-t.incoming:
+		return msg, nil
+	case <-t.closed:
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Send implements Transport.
+func (t *MemoryTransport) Send(ctx context.Context, msg *SlackMessage) error {
+	select {
+	case t.sent <- msg:
+		return nil
+	case <-t.closed:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close implements Transport.
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
+
+// OpenDM implements DirectMessenger.
+func (t *MemoryTransport) OpenDM(ctx context.Context, user string) (string, error) {
+	return "D" + user, nil
+}
+
+/*
+Deliver hands msg to the bot, blocking until the bot has received it. It
+returns ErrTransportClosed if the bot has stopped.
+*/
+func (t *MemoryTransport) Deliver(msg *IncomingMessage) error {
+	select {
+	case t.incoming <- msg:
+		return nil
+	case <-t.closed:
+		return ErrTransportClosed
+	}
+}
+
+// Sent returns the channel on which messages sent by the bot appear.
+func (t *MemoryTransport) Sent() <-chan *SlackMessage {
+	return t.sent
+}
@@ -0,0 +1,74 @@
+package gobot_test
+
+import (
+	"context"
+	"github.com/jlindsey/gobot"
+	"github.com/jlindsey/gobot/transporttest"
+	"regexp"
+	"testing"
+)
+
+func TestMemoryTransport(t *testing.T) {
+	transport := gobot.NewMemoryTransport(gobot.Identity{ID: "U0BOT", Name: "gobot"})
+	b, err := gobot.NewBot(gobot.WithTransport(transport), gobot.WithPrivateHelp())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterCommand(PingCommand{})
+	b.RegisterHandler(regexp.MustCompile(`^whisper (.+)$`), "*whisper*: Repeats something privately.",
+		gobot.HandlerFunc(func(w gobot.ResponseWriter, r *gobot.Request) error {
+			return w.DM(r.User, r.Captures[1])
+		}))
+
+	go b.Start(context.Background())
+
+	transport.Deliver(&gobot.IncomingMessage{Type: "message", Channel: "C1", User: "U1", Text: "<@U0BOT> ping"})
+	if reply := <-transport.Sent(); reply.Channel != "C1" || reply.Text != "Pong!" {
+		t.Errorf("Unexpected reply: %s", reply)
+	}
+
+	transport.Deliver(&gobot.IncomingMessage{Type: "message", Channel: "C1", User: "U1", Text: "<@U0BOT> whisper psst"})
+	if reply := <-transport.Sent(); reply.Channel != "DU1" || reply.Text != "psst" {
+		t.Errorf("Unexpected DM: %s", reply)
+	}
+
+	transport.Deliver(&gobot.IncomingMessage{Type: "message", Channel: "C1", User: "U0BOT", Text: "<@U0BOT> ping"})
+	transport.Deliver(&gobot.IncomingMessage{Type: "message", Channel: "C1", User: "U1", Text: "<@U0BOT> help"})
+	if reply := <-transport.Sent(); reply.Channel != "DU1" {
+		t.Errorf("Expected help by DM, got %s", reply)
+	}
+
+	b.Stop()
+	if err := b.Wait(); err != nil {
+		t.Errorf("Expected a clean shutdown, got %s", err)
+	}
+	if err := transport.Deliver(&gobot.IncomingMessage{Type: "message", Text: "late"}); err != gobot.ErrTransportClosed {
+		t.Errorf("Expected ErrTransportClosed after stopping, got %v", err)
+	}
+}
+
+func TestMemoryTransportChecks(t *testing.T) {
+	transporttest.Run(t, func(t *testing.T) *transporttest.Fixture {
+		transport := gobot.NewMemoryTransport(gobot.Identity{ID: "U0BOT", Name: "gobot"})
+		return &transporttest.Fixture{
+			Transport: transport,
+			// Deliver blocks until the message is received, which the check does next.
+			Deliver: func(text string) {
+				go transport.Deliver(&gobot.IncomingMessage{Type: "message", Channel: "C1", User: "U1", Text: text})
+			},
+			Sent: func() string { return (<-transport.Sent()).Text },
+		}
+	})
+}
+
+func TestMemoryTransportNeedsNoToken(t *testing.T) {
+	t.Setenv("SLACK_API_TOKEN", "")
+
+	b, err := gobot.NewBot(gobot.WithTransport(gobot.NewMemoryTransport(gobot.Identity{ID: "U0BOT"})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.PostMessage(context.Background(), gobot.NewSlackMessage("C1", "hi")); err == nil {
+		t.Error("Expected Slack Web API calls to fail without a token")
+	}
+}
@@ -3,28 +3,82 @@ package gobot
 import (
 	"encoding/json"
 	"fmt"
-	"sync/atomic"
-)
-
-var (
-	msgID uint32
+	"strings"
 )
 
 /*
 SlackMessage encapsulates a single (outgoing) Slack message payload.
-Incoming messages are handled by the gabs library for flexibility.
+Incoming messages are decoded into IncomingMessage.
 
 Slack messages must contain a sequentially-incrementing ID field
 to ensure Slack displays the messages in proper order even if they
-are sent or received out of order. Gobot maintains a uint32 counter
-and atomically generates the next ID within the NewSlackMessage method,
-so this type should never be used on its own and should always be
-acquired via that method.
+are sent or received out of order. Each Bot maintains its own uint32
+counter and atomically assigns the next ID as the message is written
+to the socket, so the ID is not set until the message is sent.
+
+The RTM socket only supports plain text. Messages that set Blocks,
+Attachments, Username, an icon, or NoUnfurl are sent with the
+chat.postMessage Web API method instead; the bot picks automatically.
+When blocks or attachments are used, Text becomes the notification
+fallback.
 */
 type SlackMessage struct {
 	id      uint32
 	Channel string
 	Text    string
+
+	// ThreadTS posts the message as a reply in the thread rooted at that timestamp.
+	ThreadTS string
+	// ReplyBroadcast also shows a threaded reply in the channel.
+	ReplyBroadcast bool
+
+	// Blocks holds Block Kit layout blocks. It can be any value that marshals to a JSON array.
+	Blocks      interface{}
+	Attachments []Attachment
+
+	Username  string
+	IconEmoji string
+	IconURL   string
+	// NoUnfurl stops Slack from unfurling links and media in the message.
+	NoUnfurl bool
+}
+
+/*
+Attachment is a legacy Slack message attachment. See
+https://api.slack.com/reference/messaging/attachments for the meaning of
+each field.
+*/
+type Attachment struct {
+	Fallback   string            `json:"fallback,omitempty"`
+	Color      string            `json:"color,omitempty"`
+	Pretext    string            `json:"pretext,omitempty"`
+	AuthorName string            `json:"author_name,omitempty"`
+	AuthorLink string            `json:"author_link,omitempty"`
+	AuthorIcon string            `json:"author_icon,omitempty"`
+	Title      string            `json:"title,omitempty"`
+	TitleLink  string            `json:"title_link,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Fields     []AttachmentField `json:"fields,omitempty"`
+	ImageURL   string            `json:"image_url,omitempty"`
+	ThumbURL   string            `json:"thumb_url,omitempty"`
+	Footer     string            `json:"footer,omitempty"`
+	FooterIcon string            `json:"footer_icon,omitempty"`
+	TS         int64             `json:"ts,omitempty"`
+	MrkdwnIn   []string          `json:"mrkdwn_in,omitempty"`
+	Blocks     interface{}       `json:"blocks,omitempty"`
+}
+
+// AttachmentField is a single title/value pair shown in a table within an Attachment.
+type AttachmentField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short,omitempty"`
+}
+
+// isRich reports whether the message needs the Web API rather than RTM.
+func (s *SlackMessage) isRich() bool {
+	return s.Blocks != nil || len(s.Attachments) > 0 || s.Username != "" ||
+		s.IconEmoji != "" || s.IconURL != "" || s.NoUnfurl
 }
 
 /*
@@ -34,22 +88,128 @@ the "type" (which for us is always "message").
 */
 func (s SlackMessage) MarshalJSON() ([]byte, error) {
 	Log.Debugf("Marshaling Slack Message: %s", s)
-	return json.Marshal(map[string]interface{}{
+	payload := map[string]interface{}{
 		"id":      s.id,
 		"type":    "message",
 		"channel": s.Channel,
 		"text":    s.Text,
-	})
+	}
+	if s.ThreadTS != "" {
+		payload["thread_ts"] = s.ThreadTS
+		if s.ReplyBroadcast {
+			payload["reply_broadcast"] = true
+		}
+	}
+	return json.Marshal(payload)
+}
+
+/*
+webhookPayload returns the message as the JSON object accepted by
+response_url endpoints for interactions and slash commands.
+*/
+func (s *SlackMessage) webhookPayload() map[string]interface{} {
+	payload := map[string]interface{}{
+		"text": s.Text,
+	}
+	if s.ThreadTS != "" {
+		payload["thread_ts"] = s.ThreadTS
+	}
+	if s.Blocks != nil {
+		payload["blocks"] = s.Blocks
+	}
+	if len(s.Attachments) > 0 {
+		payload["attachments"] = s.Attachments
+	}
+	return payload
 }
 
 // String implements the Stringer interface.
 func (s SlackMessage) String() string {
-	return fmt.Sprintf("slackMessage{ID: %d Channel: %s, Text: %s}", s.id, s.Channel, s.Text)
+	return fmt.Sprintf("slackMessage{ID: %d Channel: %s, ThreadTS: %s, Text: %s}", s.id, s.Channel, s.ThreadTS, s.Text)
 }
 
-// NewSlackMessage returns a new SlackMessage with the next atomically-incremented message ID.
+// NewSlackMessage returns a new SlackMessage for the given channel and text.
 func NewSlackMessage(channel string, text string) *SlackMessage {
 	Log.Debugf("New slack message: %s, %s", channel, text)
-	nextID := atomic.AddUint32(&msgID, 1)
-	return &SlackMessage{nextID, channel, text}
+	return &SlackMessage{Channel: channel, Text: text}
+}
+
+/*
+IncomingMessage is a single event received from Slack. Only the fields
+common to message events are decoded; everything else can be read from
+Raw, which holds the event exactly as Slack sent it.
+
+Not every event carries every field. Edits (subtype "message_changed"),
+for example, have no top-level Text, and Edited is only set on messages
+that have been edited. Events such as user_change and channel_created
+carry a whole user or channel object rather than an ID; Channel and User
+are left empty for those.
+*/
+type IncomingMessage struct {
+	Type     string  `json:"type"`
+	Subtype  string  `json:"subtype,omitempty"`
+	Channel  string  `json:"channel"`
+	User     string  `json:"user"`
+	Text     string  `json:"text"`
+	TS       string  `json:"ts"`
+	ThreadTS string  `json:"thread_ts,omitempty"`
+	BotID    string  `json:"bot_id,omitempty"`
+	Edited   *Edited `json:"edited,omitempty"`
+
+	// ReplyTo is set on acknowledgements of messages the bot sent, such as pongs.
+	ReplyTo uint32 `json:"reply_to,omitempty"`
+
+	// DirectMessage is set by the transport when the message was sent to the bot privately
+	// rather than in a channel. DMs don't need to be addressed to the bot.
+	DirectMessage bool `json:"-"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+// Edited records who last edited a message, and when.
+type Edited struct {
+	User string `json:"user"`
+	TS   string `json:"ts"`
+}
+
+/*
+ParseIncomingMessage decodes a raw Slack event. DirectMessage is set for
+events in IM channels.
+*/
+func ParseIncomingMessage(raw []byte) (*IncomingMessage, error) {
+	// plain drops IncomingMessage's methods so decoding into it doesn't recurse.
+	type plain IncomingMessage
+	msg := &IncomingMessage{}
+	event := struct {
+		*plain
+		Channel json.RawMessage `json:"channel"`
+		User    json.RawMessage `json:"user"`
+	}{plain: (*plain)(msg)}
+
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return nil, err
+	}
+	msg.Channel = idField(event.Channel)
+	msg.User = idField(event.User)
+	msg.DirectMessage = isDirectMessage(msg.Channel)
+	msg.Raw = append(json.RawMessage(nil), raw...)
+	return msg, nil
+}
+
+// idField returns the ID in a "channel" or "user" field, or "" if it holds an object instead.
+func idField(raw json.RawMessage) string {
+	var id string
+	json.Unmarshal(raw, &id)
+	return id
+}
+
+// isDirectMessage reports whether channel is a Slack IM channel ID.
+func isDirectMessage(channel string) bool {
+	return strings.HasPrefix(channel, "D")
+}
+
+// String implements the Stringer interface.
+func (m IncomingMessage) String() string {
+	return fmt.Sprintf("IncomingMessage{Type: %s, Subtype: %s, Channel: %s, User: %s, TS: %s, Text: %s}",
+		m.Type, m.Subtype, m.Channel, m.User, m.TS, m.Text)
 }
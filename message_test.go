@@ -0,0 +1,79 @@
+package gobot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseIncomingMessage(t *testing.T) {
+	raw := `{"type": "message", "channel": "C1", "user": "U1", "text": "hi", "ts": "1.2",
+		"thread_ts": "1.0", "edited": {"user": "U1", "ts": "1.3"}}`
+
+	msg, err := ParseIncomingMessage([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.Channel != "C1" || msg.User != "U1" || msg.Text != "hi" || msg.TS != "1.2" || msg.ThreadTS != "1.0" {
+		t.Errorf("Fields not decoded: %+v", msg)
+	}
+	if msg.Edited == nil || msg.Edited.TS != "1.3" {
+		t.Errorf("Edited not decoded: %+v", msg.Edited)
+	}
+	if string(msg.Raw) != raw {
+		t.Errorf("Raw payload not kept: %s", msg.Raw)
+	}
+}
+
+func TestParseEventsWithObjects(t *testing.T) {
+	events := []string{
+		`{"type": "user_change", "user": {"id": "U1", "name": "alice"}}`,
+		`{"type": "team_join", "user": {"id": "U2", "name": "bob"}}`,
+		`{"type": "channel_created", "channel": {"id": "C9", "name": "ops", "creator": "U1"}}`,
+		`{"type": "im_created", "user": "U1", "channel": {"id": "D9"}}`,
+	}
+	for _, raw := range events {
+		msg, err := ParseIncomingMessage([]byte(raw))
+		if err != nil {
+			t.Errorf("Unable to parse %s: %s", raw, err)
+			continue
+		}
+		if msg.Channel != "" || string(msg.Raw) != raw {
+			t.Errorf("Unexpected message from %s: %+v", raw, msg)
+		}
+	}
+
+	if msg, _ := ParseIncomingMessage([]byte(events[3])); msg.User != "U1" {
+		t.Errorf("Expected string fields alongside objects to be kept, got %q", msg.User)
+	}
+}
+
+func TestMessageChangedWithoutTextIsIgnored(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	ran := make(chan string, 1)
+	b.RegisterCommand(recordCommand{"ping", ran})
+
+	dispatch(t, b, `{"type": "message", "subtype": "message_changed", "channel": "C1",
+		"message": {"text": "<@U0BOT> ping"}}`)
+
+	if len(ran) != 0 {
+		t.Error("Expected message_changed events to be ignored")
+	}
+}
+
+func TestSlackMessageMarshalsThread(t *testing.T) {
+	msg := NewSlackMessage("C1", "hi")
+	msg.ThreadTS = "1.0"
+	msg.ReplyBroadcast = true
+
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var payload map[string]interface{}
+	json.Unmarshal(raw, &payload)
+	if payload["thread_ts"] != "1.0" || payload["reply_broadcast"] != true {
+		t.Errorf("Thread fields not marshaled: %s", raw)
+	}
+}
@@ -0,0 +1,254 @@
+package gobot
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/op/go-logging"
+	"net/http"
+	"time"
+)
+
+/*
+Option configures a Bot. Options are passed to NewBot and applied in order,
+so later options override earlier ones.
+*/
+type Option func(*config)
+
+// config collects the settings assembled from Options before NewBot builds the Bot.
+type config struct {
+	token            string
+	apiBaseURL       string
+	httpClient       *http.Client
+	dialer           *websocket.Dialer
+	logger           *logging.Logger
+	sendQueueSize    int
+	messageQueueSize int
+	commandQueueSize int
+	reconnectPolicy  ReconnectPolicy
+	shutdownTimeout  time.Duration
+	pingInterval     time.Duration
+	maxMissedPongs   int
+
+	threadedReplyLength int
+	privateHelp         bool
+	botPolicy           BotPolicy
+	allowedBots         []string
+
+	addressings        []Addressing
+	channelAddressings map[string][]Addressing
+
+	signingSecret string
+	eventsAPI     bool
+	socketMode    bool
+	appToken      string
+
+	transport Transport
+}
+
+/*
+WithToken sets the Slack API token, taking precedence over the
+SLACK_API_TOKEN environment variable. Bots using a non-Slack transport
+don't need one.
+*/
+func WithToken(token string) Option {
+	return func(c *config) {
+		c.token = token
+	}
+}
+
+/*
+WithAPIBaseURL sets the base URL that Web API method names (eg. "rtm.start")
+are appended to. It defaults to https://slack.com/api/ and is mostly useful
+for pointing the bot at a local Slack stand-in.
+*/
+func WithAPIBaseURL(baseURL string) Option {
+	return func(c *config) {
+		c.apiBaseURL = baseURL
+	}
+}
+
+/*
+WithQueueSizes sets the buffer sizes of the outgoing message queue, the
+incoming message queue and the command invocation queue. Values less than
+zero are ignored.
+*/
+func WithQueueSizes(send, message, command int) Option {
+	return func(c *config) {
+		if send >= 0 {
+			c.sendQueueSize = send
+		}
+		if message >= 0 {
+			c.messageQueueSize = message
+		}
+		if command >= 0 {
+			c.commandQueueSize = command
+		}
+	}
+}
+
+// WithHTTPClient sets the client used for Web API calls. It defaults to http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// WithDialer sets the dialer used to open Slack websockets. It defaults to websocket.DefaultDialer.
+func WithDialer(dialer *websocket.Dialer) Option {
+	return func(c *config) {
+		c.dialer = dialer
+	}
+}
+
+/*
+WithLogger sets the logger the bot writes to. It defaults to the package Log.
+Transports passed to WithTransport keep their own logger; the irc,
+mattermost and discord transports take one in their Config. NewSlackMessage
+and SlackMessage's MarshalJSON belong to no bot, so their debug logging
+always goes to the package Log.
+*/
+func WithLogger(logger *logging.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithReconnectPolicy sets how the bot reconnects after losing its Slack websocket.
+func WithReconnectPolicy(p ReconnectPolicy) Option {
+	return func(c *config) {
+		c.reconnectPolicy = p
+	}
+}
+
+/*
+WithShutdownTimeout sets how long a stopping bot waits for running commands
+to finish and queued messages to be sent before closing its transport.
+It defaults to 10 seconds.
+*/
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.shutdownTimeout = d
+	}
+}
+
+/*
+WithKeepalive sets how often the bot pings Slack over the RTM socket and how
+many consecutive pings may go unanswered before the connection is treated
+as dead and reconnected. It defaults to a ping every 30 seconds with 2
+missed pongs allowed. An interval of zero disables keepalive.
+*/
+func WithKeepalive(interval time.Duration, maxMissed int) Option {
+	return func(c *config) {
+		c.pingInterval = interval
+		if maxMissed > 0 {
+			c.maxMissedPongs = maxMissed
+		}
+	}
+}
+
+/*
+WithThreadedReplies makes replies of at least minLength characters start a
+thread on the triggering message instead of posting to the channel, which
+keeps channels readable when commands produce long output.
+*/
+func WithThreadedReplies(minLength int) Option {
+	return func(c *config) {
+		c.threadedReplyLength = minLength
+	}
+}
+
+/*
+WithPrivateHelp makes the bot answer help requests made in channels with a
+direct message to the person who asked, rather than posting the command
+list to the whole channel.
+*/
+func WithPrivateHelp() Option {
+	return func(c *config) {
+		c.privateHelp = true
+	}
+}
+
+/*
+WithBotPolicy sets how messages from other bots are treated. With
+AllowListedBots, only messages whose bot_id is in botIDs are accepted.
+The default is IgnoreBots.
+*/
+func WithBotPolicy(policy BotPolicy, botIDs ...string) Option {
+	return func(c *config) {
+		c.botPolicy = policy
+		c.allowedBots = botIDs
+	}
+}
+
+/*
+WithAddressing sets the ways a channel message can be addressed to the bot,
+eg. WithAddressing(MentionAnywhere, NamePrefix, Sigil("!")). They are tried
+in order. See Addressing for details.
+*/
+func WithAddressing(modes ...Addressing) Option {
+	return func(c *config) {
+		c.addressings = modes
+	}
+}
+
+/*
+WithChannelAddressing overrides the addressings for a single channel ID.
+Passing no modes means messages in that channel are never addressed to the
+bot, which limits it to listeners there.
+*/
+func WithChannelAddressing(channel string, modes ...Addressing) Option {
+	return func(c *config) {
+		c.channelAddressings[channel] = modes
+	}
+}
+
+/*
+WithSigningSecret sets the app's signing secret, used to verify that HTTP
+requests such as interactions really come from Slack. HTTP endpoints
+reject every request until it is set.
+*/
+func WithSigningSecret(secret string) Option {
+	return func(c *config) {
+		c.signingSecret = secret
+	}
+}
+
+/*
+WithEventsAPI makes the bot receive messages from the Events API instead of
+the RTM websocket, which Slack no longer offers to new apps. Start then
+identifies the bot with auth.test and sends every message through
+chat.postMessage; incoming events are delivered by mounting
+Bot.EventsHandler on the app's Request URL. NewBot fails unless a signing
+secret is also set with WithSigningSecret.
+*/
+func WithEventsAPI() Option {
+	return func(c *config) {
+		c.eventsAPI = true
+	}
+}
+
+/*
+WithSocketMode makes the bot receive events over a Socket Mode websocket
+opened with the given app-level token (xapp-...), for bots that can't accept
+inbound HTTP. As with WithEventsAPI, the bot identifies itself with
+auth.test and sends every message through chat.postMessage using its bot
+token.
+*/
+func WithSocketMode(appToken string) Option {
+	return func(c *config) {
+		c.socketMode = true
+		c.appToken = appToken
+	}
+}
+
+/*
+WithTransport connects the bot through t instead of one of the Slack
+transports, for example to run it on another chat service or, with a
+MemoryTransport, in tests. The Slack-specific options (WithDialer,
+WithKeepalive, WithReconnectPolicy, WithEventsAPI and WithSocketMode) have
+no effect on it.
+*/
+func WithTransport(t Transport) Option {
+	return func(c *config) {
+		c.transport = t
+	}
+}
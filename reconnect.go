@@ -0,0 +1,96 @@
+package gobot
+
+import (
+	"fmt"
+	"github.com/op/go-logging"
+	"math/rand"
+	"time"
+)
+
+/*
+ReconnectPolicy controls how the bot re-establishes its Slack connection
+after the websocket drops.
+
+The delay before each attempt starts at MinBackoff and doubles after every
+failure up to MaxBackoff. Each delay is jittered to a random value between
+half and all of the computed backoff so that several bots dropped at the
+same time don't hammer Slack in lockstep. MaxAttempts limits the number of
+consecutive failed attempts before the bot gives up; zero means retry forever.
+A zero MinBackoff or MaxBackoff takes its value from DefaultReconnectPolicy.
+
+Transports that reconnect their own connections use the same policy through
+Retry.
+*/
+type ReconnectPolicy struct {
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+/*
+DefaultReconnectPolicy is the policy used by bots returned from NewBot
+unless overridden with WithReconnectPolicy.
+*/
+var DefaultReconnectPolicy = ReconnectPolicy{
+	MinBackoff:  time.Second,
+	MaxBackoff:  2 * time.Minute,
+	MaxAttempts: 0,
+}
+
+// Delay returns the jittered wait before the given (1-indexed) attempt.
+func (p ReconnectPolicy) Delay(attempt int) time.Duration {
+	return jitter(p.backoff(attempt))
+}
+
+// backoff returns the un-jittered delay before the given (1-indexed) attempt.
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = DefaultReconnectPolicy.MinBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultReconnectPolicy.MaxBackoff
+	}
+
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+/*
+Retry calls attempt until it succeeds, waiting Delay before each call and
+logging the attempts that fail to log. It returns ErrTransportClosed as soon
+as closed is closed, and an error once MaxAttempts calls have failed.
+*/
+func (p ReconnectPolicy) Retry(closed <-chan struct{}, log *logging.Logger, attempt func(n int) error) error {
+	for n := 1; p.MaxAttempts == 0 || n <= p.MaxAttempts; n++ {
+		wait := p.Delay(n)
+		log.Infof("Reconnecting in %s (attempt %d)", wait, n)
+
+		select {
+		case <-time.After(wait):
+		case <-closed:
+			return ErrTransportClosed
+		}
+
+		if err := attempt(n); err != nil {
+			log.Errorf("Reconnect attempt %d failed: %s", n, err)
+			continue
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Unable to reconnect after %d attempts", p.MaxAttempts)
+}
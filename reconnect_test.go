@@ -0,0 +1,64 @@
+package gobot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	tests := []struct {
+		policy   ReconnectPolicy
+		attempt  int
+		min, max time.Duration
+	}{
+		{ReconnectPolicy{MinBackoff: time.Second, MaxBackoff: time.Minute}, 1, 500 * time.Millisecond, time.Second},
+		{ReconnectPolicy{MinBackoff: time.Second, MaxBackoff: time.Minute}, 3, 2 * time.Second, 4 * time.Second},
+		{ReconnectPolicy{MinBackoff: time.Second, MaxBackoff: 3 * time.Second}, 10, 1500 * time.Millisecond, 3 * time.Second},
+		// Zero fields fall back to DefaultReconnectPolicy one by one.
+		{ReconnectPolicy{MaxAttempts: 5}, 1, 500 * time.Millisecond, time.Second},
+		{ReconnectPolicy{MaxAttempts: 5}, 20, time.Minute, 2 * time.Minute},
+		{ReconnectPolicy{MaxBackoff: 4 * time.Second}, 2, time.Second, 2 * time.Second},
+		{ReconnectPolicy{MinBackoff: time.Hour}, 1, time.Minute, 2 * time.Minute},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if d := test.policy.Delay(test.attempt); d < test.min || d > test.max {
+				t.Errorf("%+v.Delay(%d) = %s, want between %s and %s", test.policy, test.attempt, d, test.min, test.max)
+				break
+			}
+		}
+	}
+}
+
+func TestReconnectPolicyRetry(t *testing.T) {
+	policy := ReconnectPolicy{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond, MaxAttempts: 3}
+
+	var attempts []int
+	err := policy.Retry(nil, Log, func(n int) error {
+		attempts = append(attempts, n)
+		if n < 2 {
+			return errors.New("Refused")
+		}
+		return nil
+	})
+	if err != nil || len(attempts) != 2 || attempts[1] != 2 {
+		t.Errorf("Expected success on the second attempt, got %v after %v", err, attempts)
+	}
+
+	err = policy.Retry(nil, Log, func(int) error { return errors.New("Refused") })
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("Expected Retry to give up after 3 attempts, got %v", err)
+	}
+
+	closed := make(chan struct{})
+	close(closed)
+	err = ReconnectPolicy{MinBackoff: time.Hour}.Retry(closed, Log, func(int) error {
+		t.Error("Unexpected attempt after closing")
+		return nil
+	})
+	if err != ErrTransportClosed {
+		t.Errorf("Expected ErrTransportClosed, got %v", err)
+	}
+}
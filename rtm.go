@@ -0,0 +1,169 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/url"
+	"sync/atomic"
+)
+
+/*
+rtmTransport connects to Slack's RTM websocket. It is the transport used
+unless another is chosen with WithEventsAPI, WithSocketMode or
+WithTransport.
+
+Plain messages are written to the websocket, and held while it is
+reconnecting; rich ones are posted with the Web API.
+*/
+type rtmTransport struct {
+	slackSocket
+
+	msgID   uint32
+	latency int64
+}
+
+func newRTMTransport(api *slackClient, cfg socketConfig) *rtmTransport {
+	return &rtmTransport{slackSocket: newSlackSocket(api, cfg)}
+}
+
+// Connect implements Transport.
+func (t *rtmTransport) Connect(ctx context.Context) (*Identity, error) {
+	socketURL, self, err := t.startRTM(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := t.dial(socketURL)
+	if err != nil {
+		return nil, err
+	}
+	t.log.Infof("Connected to %s as %s!", self.Team, self.Name)
+
+	t.setConn(conn)
+	go t.run(conn, t.read, t.redial)
+	return self, nil
+}
+
+// startRTM calls rtm.start, returning the websocket URL to dial and who the bot is.
+func (t *rtmTransport) startRTM(ctx context.Context) (*url.URL, *Identity, error) {
+	t.log.Info("Calling Slack RTM start")
+
+	params := url.Values{}
+	params.Set("simple_latest", "true")
+	params.Set("no_unreads", "true")
+
+	parsedBody, err := t.callAPI(ctx, "rtm.start", params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rawURL, _ := parsedBody.Path("url").Data().(string)
+	socketURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, &DialError{URL: rawURL, Err: err}
+	}
+
+	self := &Identity{}
+	self.Team, _ = parsedBody.Path("team.name").Data().(string)
+	self.Name, _ = parsedBody.Path("self.name").Data().(string)
+	self.ID, _ = parsedBody.Path("self.id").Data().(string)
+
+	return socketURL, self, nil
+}
+
+func (t *rtmTransport) redial() (*websocket.Conn, error) {
+	socketURL, _, err := t.startRTM(t.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.dial(socketURL)
+}
+
+/*
+read reads from conn until it fails. RTM pong replies are consumed here and
+passed to the connection's keepalive rather than being delivered as
+messages.
+*/
+func (t *rtmTransport) read(conn *websocket.Conn) (*websocket.Conn, error) {
+	closed := make(chan struct{})
+	defer close(closed)
+
+	ka := t.startKeepalive(conn, closed)
+
+	for {
+		msgType, msg, err := conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		t.log.Debugf("Raw incoming message: [%d] %s", msgType, msg)
+
+		if ka != nil {
+			ka.extendDeadline()
+		}
+
+		if msgType == websocket.TextMessage {
+			parsedMsg, err := ParseIncomingMessage(msg)
+			if err != nil {
+				t.log.Errorf("Error parsing message: %s", err)
+				continue
+			}
+			if parsedMsg.Type == "pong" {
+				if ka != nil {
+					ka.pong(parsedMsg.ReplyTo)
+				}
+				continue
+			}
+			t.deliver(parsedMsg)
+		}
+	}
+}
+
+// Send implements Transport.
+func (t *rtmTransport) Send(ctx context.Context, msg *SlackMessage) error {
+	if msg.isRich() {
+		return t.postQueuedMessage(ctx, msg)
+	}
+
+	for {
+		conn, connected := t.current()
+		if conn != nil {
+			err := t.write(conn, msg)
+			if err == nil {
+				return nil
+			}
+			// The socket died before the reader noticed; hold the message for the next one.
+			t.log.Warningf("Unable to write to Slack, holding message until reconnected: %s", err)
+			t.dropConn(conn)
+			continue
+		}
+
+		t.log.Debugf("Holding message until reconnected: %s", msg)
+		select {
+		case <-connected:
+		case <-t.stopped:
+			return t.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// nextMessageID atomically generates the next outgoing message ID for this connection.
+func (t *rtmTransport) nextMessageID() uint32 {
+	return atomic.AddUint32(&t.msgID, 1)
+}
+
+func (t *rtmTransport) write(conn *websocket.Conn, msg *SlackMessage) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	msg.id = t.nextMessageID()
+	str, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.log.Debugf("Sending json: %s", str)
+	return conn.WriteMessage(websocket.TextMessage, str)
+}
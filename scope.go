@@ -0,0 +1,40 @@
+package gobot
+
+/*
+Scope controls where a command or handler may be triggered: in channels
+(public or private), in direct messages with the bot, or both.
+*/
+type Scope int
+
+const (
+	// InChannels allows triggering from channels, where the bot must be mentioned.
+	InChannels Scope = 1 << iota
+	// InDirectMessages allows triggering from DMs, where the mention is optional.
+	InDirectMessages
+
+	// Anywhere allows triggering from both channels and DMs.
+	Anywhere = InChannels | InDirectMessages
+)
+
+/*
+ScopedCommand is a Command that restricts where it may be triggered.
+If a registered Command implements ScopedCommand, its Scope is consulted
+before Matches; otherwise the command runs Anywhere.
+*/
+type ScopedCommand interface {
+	Command
+	Scope() Scope
+}
+
+// In restricts the route to the given scope and returns it for chaining.
+func (r *Route) In(s Scope) *Route {
+	r.scope = s
+	return r
+}
+
+func (s Scope) allows(dm bool) bool {
+	if dm {
+		return s&InDirectMessages != 0
+	}
+	return s&InChannels != 0
+}
@@ -0,0 +1,81 @@
+package gobot
+
+import (
+	"testing"
+)
+
+// scopedCommand is a recordCommand restricted to a scope.
+type scopedCommand struct {
+	recordCommand
+	scope Scope
+}
+
+func (s scopedCommand) Scope() Scope { return s.scope }
+
+func TestDirectMessagesDoNotNeedMention(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	ran := make(chan string, 5)
+	b.RegisterCommand(recordCommand{"ping", ran})
+
+	dispatch(t, b, `{"type": "message", "channel": "D1", "text": "ping"}`)
+	dispatch(t, b, `{"type": "message", "channel": "D1", "text": "<@U0BOT> ping"}`)
+	dispatch(t, b, `{"type": "message", "channel": "C1", "text": "ping"}`)
+
+	if len(ran) != 2 {
+		t.Errorf("Expected 2 runs from DMs only, got %d", len(ran))
+	}
+}
+
+func TestDirectMessageFlag(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	ran := make(chan string, 5)
+	b.RegisterCommand(recordCommand{"ping", ran})
+
+	dispatchMessage(b, &IncomingMessage{Type: "message", Channel: "Dave", User: "Dave", Text: "ping"})
+	dispatchMessage(b, &IncomingMessage{Type: "message", Channel: "alice", User: "alice", Text: "ping", DirectMessage: true})
+
+	if len(ran) != 1 || <-ran != "alice" {
+		t.Error("Expected only the message flagged as a DM to run without a mention")
+	}
+}
+
+func TestCommandScopes(t *testing.T) {
+	b := newIdentifiedBot(t, "U0BOT")
+	channelRan := make(chan string, 5)
+	dmRan := make(chan string, 5)
+	b.RegisterCommand(scopedCommand{recordCommand{"deploy", channelRan}, InChannels})
+	b.RegisterCommand(scopedCommand{recordCommand{"secret", dmRan}, InDirectMessages})
+
+	for _, channel := range []string{"C1", "D1"} {
+		dispatch(t, b, `{"type": "message", "channel": "`+channel+`", "text": "<@U0BOT> deploy"}`)
+		dispatch(t, b, `{"type": "message", "channel": "`+channel+`", "text": "<@U0BOT> secret"}`)
+	}
+
+	if len(channelRan) != 1 || <-channelRan != "C1" {
+		t.Error("Expected channel-only command to run only in C1")
+	}
+	if len(dmRan) != 1 || <-dmRan != "D1" {
+		t.Error("Expected DM-only command to run only in D1")
+	}
+}
+
+func TestPrivateHelp(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.responses["conversations.open"] = map[string]interface{}{
+		"ok": true, "channel": map[string]interface{}{"id": "D9"},
+	}
+
+	b, err := NewBot(append(slack.options(), WithPrivateHelp())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.setIdentity(&Identity{ID: "U0BOT"})
+	b.RegisterCommand(recordCommand{"ping", make(chan string, 1)})
+	b.extractHelps()
+
+	dispatch(t, b, `{"type": "message", "channel": "C1", "user": "U1", "text": "<@U0BOT> help"}`)
+
+	if msg := <-b.sendQueue; msg.Channel != "D9" {
+		t.Errorf("Expected help to be sent by DM, got %s", msg)
+	}
+}
@@ -0,0 +1,136 @@
+package gobot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ShutdownError is returned by Start and Wait when the bot's shutdown timeout
+expired before every running command finished and every queued message was
+sent.
+*/
+type ShutdownError struct {
+	AbandonedCommands int
+	AbandonedMessages int
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("Shutdown timed out, abandoned %d commands and %d messages",
+		e.AbandonedCommands, e.AbandonedMessages)
+}
+
+/*
+shutdown stops the bot gracefully. Commands already running are given until
+the shutdown timeout to finish, and any messages they send in the meantime
+are still delivered. Once they are done, the outgoing queue is flushed and
+only then is the transport closed.
+*/
+func (b *Bot) shutdown() error {
+	b.log.Info("Closing gracefully")
+	timeout, cancel := context.WithTimeout(context.Background(), b.shutdownTimeout)
+	defer cancel()
+	deadline := timeout.Done()
+
+	// Handlers still matching messages may queue one last command.
+	b.waitForHandlers(deadline)
+	abandonedCommands := b.dropQueuedCommands()
+	abandonedMessages := 0
+
+	commandsDone := waitGroupDone(&b.inflightCommands)
+	timedOut := false
+
+	// Keep delivering messages while running commands finish.
+waitCommands:
+	for {
+		select {
+		case msg := <-b.sendQueue:
+			b.send(msg)
+		case <-commandsDone:
+			break waitCommands
+		case <-deadline:
+			timedOut = true
+			abandonedCommands += int(atomic.LoadInt32(&b.runningCommands))
+			break waitCommands
+		}
+	}
+
+	// Flush whatever is left in the outgoing queue.
+	if !timedOut {
+	flush:
+		for {
+			select {
+			case msg := <-b.sendQueue:
+				b.send(msg)
+			default:
+				break flush
+			}
+		}
+
+		select {
+		case <-waitGroupDone(&b.inflightSends):
+		case <-deadline:
+			timedOut = true
+		}
+	}
+	if timedOut {
+		abandonedMessages += len(b.sendQueue) + int(atomic.LoadInt32(&b.pendingSends))
+	}
+
+	b.cancelSends()
+	if err := b.transport.Close(); err != nil {
+		b.log.Errorf("Error closing transport: %s", err)
+	}
+
+	if abandonedCommands > 0 || abandonedMessages > 0 {
+		err := &ShutdownError{abandonedCommands, abandonedMessages}
+		b.log.Warning(err)
+		return err
+	}
+	return nil
+}
+
+/*
+waitForHandlers waits until no incoming message is being handled, or until
+deadline, delivering any replies they send meanwhile.
+*/
+func (b *Bot) waitForHandlers(deadline <-chan struct{}) {
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+
+	for atomic.LoadInt32(&b.handlingMessages) > 0 {
+		select {
+		case msg := <-b.sendQueue:
+			b.send(msg)
+		case <-ticker.C:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// dropQueuedCommands discards invocations that were queued but never started.
+func (b *Bot) dropQueuedCommands() int {
+	dropped := 0
+	for {
+		select {
+		case <-b.commandQueue:
+			dropped++
+		default:
+			return dropped
+		}
+	}
+}
+
+// waitGroupDone returns a channel that is closed once wg's counter reaches zero.
+func waitGroupDone(wg *sync.WaitGroup) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
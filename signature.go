@@ -0,0 +1,67 @@
+package gobot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	signatureVersion = "v0"
+	// maxRequestAge is how old a signed request may be before it is rejected as a possible replay.
+	maxRequestAge = 5 * time.Minute
+	// maxRequestBody bounds the size of the HTTP requests Slack sends us.
+	maxRequestBody = 1 << 20
+)
+
+var errNoSigningSecret = errors.New("No signing secret configured, see WithSigningSecret")
+
+/*
+verifySlackRequest reads r's body and checks it was signed by Slack with
+the signing secret, as described at
+https://api.slack.com/authentication/verifying-requests-from-slack.
+It returns the body on success. The body is also restored on r so that
+r.ParseForm still works.
+*/
+func verifySlackRequest(secret string, r *http.Request) ([]byte, error) {
+	if secret == "" {
+		return nil, errNoSigningSecret
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxRequestBody))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read request body: %s", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Bad request timestamp %q", timestamp)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return nil, fmt.Errorf("Request timestamp %s is too far from now", timestamp)
+	}
+
+	expected := signRequest(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		return nil, errors.New("Request signature does not match")
+	}
+
+	return body, nil
+}
+
+// signRequest computes the X-Slack-Signature value for a request body.
+func signRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%s:", signatureVersion, timestamp)
+	mac.Write(body)
+	return signatureVersion + "=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,152 @@
+package gobot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+slashAckWindow is how long a slash command request waits for the handler's
+first reply before acknowledging with an empty response. Slack gives up
+after three seconds.
+*/
+var slashAckWindow = 2500 * time.Millisecond
+
+var errCannotReact = errors.New("Slash commands have no message to react to")
+
+/*
+SlashCommandHandler returns the http.Handler to use as the Request URL of
+the app's slash commands. It verifies each request with the signing secret
+given to WithSigningSecret and dispatches it to the same registry as
+@mentions: "/deploy web" is matched as the text "deploy web".
+
+Replies are ephemeral, visible only to the user who ran the command. If the
+handler replies quickly, its first reply is returned in the HTTP response
+itself; later or slower replies are posted to the command's response_url.
+DMs sent with ResponseWriter.DM go through the bot as usual.
+*/
+func (b *Bot) SlashCommandHandler() http.Handler {
+	return http.HandlerFunc(b.serveSlashCommand)
+}
+
+func (b *Bot) serveSlashCommand(w http.ResponseWriter, r *http.Request) {
+	if _, err := verifySlackRequest(b.signingSecret, r); err != nil {
+		b.log.Warningf("Rejecting slash command: %s", err)
+		http.Error(w, "invalid request", http.StatusUnauthorized)
+		return
+	}
+
+	command := strings.TrimPrefix(r.PostFormValue("command"), "/")
+	text := strings.TrimSpace(command + " " + r.PostFormValue("text"))
+	channel := r.PostFormValue("channel_id")
+
+	raw, _ := json.Marshal(r.PostForm)
+	msg := &IncomingMessage{
+		Type:          "slash_command",
+		Channel:       channel,
+		User:          r.PostFormValue("user_id"),
+		Text:          text,
+		DirectMessage: isDirectMessage(channel),
+		Raw:           raw,
+	}
+	b.log.Debugf("Slash command: %s", msg)
+
+	rt, captures := b.matchRoute(text, msg.DirectMessage)
+	if rt == nil {
+		writeSlashResponse(w, NewSlackMessage(channel, fmt.Sprintf("Sorry, I don't know how to /%s.", command)))
+		return
+	}
+
+	req := b.newRequest(rt, msg, captures)
+	sw := &slashResponseWriter{
+		responseWriter: responseWriter{bot: b, req: req},
+		responseURL:    r.PostFormValue("response_url"),
+		immediate:      make(chan *SlackMessage, 1),
+	}
+
+	finished := make(chan struct{})
+	if !b.enqueue(r.Context(), func() {
+		defer close(finished)
+		b.serveRequest(rt, sw, req)
+	}) {
+		http.Error(w, "bot unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	select {
+	case reply := <-sw.immediate:
+		writeSlashResponse(w, reply)
+		return
+	case <-finished:
+	case <-time.After(slashAckWindow):
+	}
+
+	if sw.acknowledge() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// The handler replied just as we gave up waiting.
+	writeSlashResponse(w, <-sw.immediate)
+}
+
+func writeSlashResponse(w http.ResponseWriter, msg *SlackMessage) {
+	payload := msg.webhookPayload()
+	payload["response_type"] = "ephemeral"
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
+
+/*
+slashResponseWriter is the ResponseWriter handed to handlers run by slash
+commands. The first reply is handed back to the waiting HTTP request if it
+hasn't been acknowledged yet; every other reply goes to the response_url.
+*/
+type slashResponseWriter struct {
+	responseWriter
+	responseURL string
+
+	mu        sync.Mutex
+	acked     bool
+	immediate chan *SlackMessage
+}
+
+// acknowledge marks the request as answered, reporting false if a reply got there first.
+func (w *slashResponseWriter) acknowledge() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.acked {
+		return false
+	}
+	w.acked = true
+	return true
+}
+
+func (w *slashResponseWriter) Send(msg *SlackMessage) error {
+	if w.acknowledge() {
+		w.immediate <- msg
+		return nil
+	}
+
+	payload := msg.webhookPayload()
+	payload["response_type"] = "ephemeral"
+	return w.bot.api.postResponseURL(w.req.Context(), w.responseURL, payload)
+}
+
+func (w *slashResponseWriter) Reply(text string) error {
+	return w.Send(NewSlackMessage(w.req.Channel, text))
+}
+
+func (w *slashResponseWriter) ReplyInThread(text string) error {
+	return w.Reply(text)
+}
+
+func (w *slashResponseWriter) React(emoji string) error {
+	return errCannotReact
+}
@@ -0,0 +1,140 @@
+package gobot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func slashForm(command, text, responseURL string) url.Values {
+	return url.Values{
+		"command":      {command},
+		"text":         {text},
+		"user_id":      {"U1"},
+		"channel_id":   {"C1"},
+		"response_url": {responseURL},
+	}
+}
+
+// drainCommands runs queued commands until the test ends.
+func drainCommands(t *testing.T, b *Bot) {
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		for {
+			select {
+			case run := <-b.commandQueue:
+				run()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func TestSlashCommandImmediateReply(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithSigningSecret("shh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^deploy (?P<app>\w+)$`), "deploy an app", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		return w.Reply("Deploying " + r.Params["app"] + " for " + r.User)
+	}))
+	drainCommands(t, b)
+
+	rec := httptest.NewRecorder()
+	b.SlashCommandHandler().ServeHTTP(rec, signedRequest(t, "shh", "/slack/commands", formContentType, slashForm("/deploy", "web", "").Encode()))
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Bad response %q: %s", rec.Body, err)
+	}
+	if resp["response_type"] != "ephemeral" || resp["text"] != "Deploying web for U1" {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+}
+
+func TestSlashCommandDelayedReply(t *testing.T) {
+	defer func(window time.Duration) { slashAckWindow = window }(slashAckWindow)
+	slashAckWindow = 10 * time.Millisecond
+
+	slack := newFakeSlack(t)
+	b, err := NewBot(append(slack.options(), WithSigningSecret("shh"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release := make(chan struct{})
+	b.RegisterHandler(regexp.MustCompile("^report$"), "build a report", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		<-release
+		return w.Reply("Here's your report")
+	}))
+	drainCommands(t, b)
+
+	rec := httptest.NewRecorder()
+	b.SlashCommandHandler().ServeHTTP(rec, signedRequest(t, "shh", "/slack/commands", formContentType, slashForm("/report", "", slack.URL+"/api/respond").Encode()))
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Fatalf("Expected empty acknowledgement, got %d %q", rec.Code, rec.Body)
+	}
+	close(release)
+
+	call := <-slack.calls
+	var reply map[string]interface{}
+	json.Unmarshal(call.body, &reply)
+	if call.method != "respond" || reply["response_type"] != "ephemeral" || reply["text"] != "Here's your report" {
+		t.Errorf("Unexpected delayed reply: %s %s", call.method, call.body)
+	}
+}
+
+func TestSlashCommandUnknown(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithSigningSecret("shh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	b.SlashCommandHandler().ServeHTTP(rec, signedRequest(t, "shh", "/slack/commands", formContentType, slashForm("/nope", "", "").Encode()))
+
+	var resp map[string]interface{}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp["response_type"] != "ephemeral" || resp["text"] != "Sorry, I don't know how to /nope." {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+}
+
+func TestSlashCommandRejectsBadSignature(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithSigningSecret("shh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	b.SlashCommandHandler().ServeHTTP(rec, signedRequest(t, "wrong", "/slack/commands", formContentType, slashForm("/deploy", "web", "").Encode()))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", rec.Code)
+	}
+}
+
+func TestSlashCommandAfterStop(t *testing.T) {
+	b, err := NewBot(WithToken("xoxb-test"), WithSigningSecret("shh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile("^report$"), "build a report", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		return w.Reply("Here's your report")
+	}))
+	b.Stop()
+
+	rec := httptest.NewRecorder()
+	b.SlashCommandHandler().ServeHTTP(rec, signedRequest(t, "shh", "/slack/commands", formContentType, slashForm("/report", "", "").Encode()))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the stopped bot to refuse the command, got %d %q", rec.Code, rec.Body)
+	}
+	if n := len(b.commandQueue); n != 0 {
+		t.Errorf("Expected nothing queued after Stop, got %d commands", n)
+	}
+}
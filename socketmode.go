@@ -0,0 +1,200 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"net/url"
+	"time"
+)
+
+// socketEnvelope is a single frame received over a Socket Mode websocket.
+type socketEnvelope struct {
+	Type         string          `json:"type"`
+	EnvelopeID   string          `json:"envelope_id"`
+	Reason       string          `json:"reason"`
+	RetryAttempt int             `json:"retry_attempt"`
+	RetryReason  string          `json:"retry_reason"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+/*
+socketModeTransport receives events over a Socket Mode websocket opened with
+an app-level token, for bots that can't accept inbound HTTP. Everything is
+sent through the Web API.
+*/
+type socketModeTransport struct {
+	slackSocket
+	appToken   string
+	seenEvents *eventLog
+}
+
+func newSocketModeTransport(api *slackClient, cfg socketConfig, appToken string) *socketModeTransport {
+	return &socketModeTransport{
+		slackSocket: newSlackSocket(api, cfg),
+		appToken:    appToken,
+		seenEvents:  newEventLog(eventRetention),
+	}
+}
+
+// Connect implements Transport.
+func (t *socketModeTransport) Connect(ctx context.Context) (*Identity, error) {
+	self, err := t.identify(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := t.open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t.setConn(conn)
+	go t.run(conn, t.read, func() (*websocket.Conn, error) { return t.open(t.ctx) })
+	return self, nil
+}
+
+// Send implements Transport.
+func (t *socketModeTransport) Send(ctx context.Context, msg *SlackMessage) error {
+	return t.postQueuedMessage(ctx, msg)
+}
+
+/*
+open asks Slack for a Socket Mode websocket URL with the app token and dials
+it.
+*/
+func (t *socketModeTransport) open(ctx context.Context) (*websocket.Conn, error) {
+	t.log.Info("Calling Slack apps.connections.open")
+
+	parsedBody, err := t.callAPIWithToken(ctx, t.appToken, "apps.connections.open", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rawURL, _ := parsedBody.Path("url").Data().(string)
+	socketURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, &DialError{URL: rawURL, Err: err}
+	}
+	return t.dial(socketURL)
+}
+
+/*
+read reads envelopes from conn, acknowledging each one before delivering
+its event.
+
+Slack warns a connection is about to be closed with a "disconnect" envelope.
+When that happens a replacement is opened in the background and conn is
+closed once it's ready; read then returns the replacement rather than an
+error.
+*/
+func (t *socketModeTransport) read(conn *websocket.Conn) (*websocket.Conn, error) {
+	// Slack pings Socket Mode connections itself; a connection that stops
+	// hearing from it is treated as dead.
+	extendDeadline := func() {
+		if t.pingInterval > 0 {
+			conn.SetReadDeadline(time.Now().Add(t.pingInterval * time.Duration(t.maxMissedPongs+1)))
+		}
+	}
+	extendDeadline()
+	conn.SetPingHandler(func(data string) error {
+		extendDeadline()
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+
+	var replacement chan *websocket.Conn
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			if replacement != nil {
+				if next := <-replacement; next != nil {
+					t.log.Debug("Switched to replacement Socket Mode connection")
+					return next, nil
+				}
+			}
+			return nil, err
+		}
+		t.log.Debugf("Raw incoming envelope: %s", raw)
+		extendDeadline()
+
+		var envelope socketEnvelope
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			t.log.Errorf("Error parsing envelope: %s", err)
+			continue
+		}
+
+		if envelope.EnvelopeID != "" {
+			if err := t.acknowledge(conn, envelope.EnvelopeID); err != nil {
+				t.log.Errorf("Unable to acknowledge envelope %s: %s", envelope.EnvelopeID, err)
+			}
+		}
+
+		switch envelope.Type {
+		case "hello":
+			t.log.Info("Socket Mode connection ready")
+		case "disconnect":
+			t.log.Infof("Slack is closing the Socket Mode connection (%s)", envelope.Reason)
+			if replacement == nil {
+				replacement = make(chan *websocket.Conn, 1)
+				go t.preconnect(conn, replacement)
+			}
+		case "events_api":
+			t.handleEvent(&envelope)
+		default:
+			t.log.Debugf("Ignoring %s envelope", envelope.Type)
+		}
+	}
+}
+
+func (t *socketModeTransport) acknowledge(conn *websocket.Conn, envelopeID string) error {
+	ack, err := json.Marshal(map[string]string{"envelope_id": envelopeID})
+	if err != nil {
+		return err
+	}
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	return conn.WriteMessage(websocket.TextMessage, ack)
+}
+
+func (t *socketModeTransport) handleEvent(envelope *socketEnvelope) {
+	var payload eventEnvelope
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		t.log.Errorf("Unable to parse envelope %s: %s", envelope.EnvelopeID, err)
+		return
+	}
+
+	if !t.seenEvents.add(payload.EventID) {
+		t.log.Debugf("Dropping retry %d of event %s (%s)", envelope.RetryAttempt, payload.EventID, envelope.RetryReason)
+		return
+	}
+
+	msg, err := ParseIncomingMessage(payload.Event)
+	if err != nil {
+		t.log.Errorf("Unable to parse event %s: %s", payload.EventID, err)
+		return
+	}
+	t.deliver(msg)
+}
+
+/*
+preconnect opens a replacement for old, sends it on replacement and closes
+old. If it can't, it sends nil and leaves old alone, so the usual reconnect
+takes over once Slack closes it.
+*/
+func (t *socketModeTransport) preconnect(old *websocket.Conn, replacement chan *websocket.Conn) {
+	conn, err := t.open(t.ctx)
+	if err != nil {
+		t.log.Warningf("Unable to open replacement Socket Mode connection: %s", err)
+		replacement <- nil
+		return
+	}
+
+	replacement <- conn
+	old.Close()
+}
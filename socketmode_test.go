@@ -0,0 +1,116 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func startSocketModeBot(t *testing.T) (*Bot, *fakeSlack) {
+	slack := newFakeSlack(t)
+	slack.responses["auth.test"] = map[string]interface{}{
+		"ok": true, "team": "Test Team", "user": "gobot", "user_id": "U0BOT",
+	}
+	slack.responses["apps.connections.open"] = map[string]interface{}{
+		"ok": true, "url": "ws" + strings.TrimPrefix(slack.URL, "http") + "/ws",
+	}
+
+	b, err := NewBot(append(slack.options(), WithSocketMode("xapp-test"))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile("^ping$"), "*ping*: Replies pong.", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		return w.Reply("pong")
+	}))
+
+	go b.Start(context.Background())
+	t.Cleanup(func() {
+		b.Stop()
+		b.Wait()
+	})
+
+	if call := <-slack.calls; call.method != "auth.test" {
+		t.Fatalf("Expected auth.test, got %s", call.method)
+	}
+	if call := <-slack.calls; call.method != "apps.connections.open" || call.params.Get("token") != "xapp-test" {
+		t.Fatalf("Expected apps.connections.open with the app token, got %s %s", call.method, call.params)
+	}
+	return b, slack
+}
+
+// sendEvent pushes a message event in an events_api envelope and waits for its acknowledgement.
+func sendEvent(t *testing.T, server *websocket.Conn, envelopeID, eventID, text string) {
+	envelope, _ := json.Marshal(map[string]interface{}{
+		"type":        "events_api",
+		"envelope_id": envelopeID,
+		"payload": map[string]interface{}{
+			"type":     "event_callback",
+			"event_id": eventID,
+			"event":    map[string]string{"type": "message", "channel": "C1", "user": "U1", "text": text, "ts": "1.0"},
+		},
+	})
+	if err := server.WriteMessage(websocket.TextMessage, envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	_, raw, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ack map[string]string
+	json.Unmarshal(raw, &ack)
+	if ack["envelope_id"] != envelopeID {
+		t.Fatalf("Expected ack for %s, got %s", envelopeID, raw)
+	}
+}
+
+func expectPong(t *testing.T, slack *fakeSlack) {
+	call := <-slack.calls
+	if call.method != "chat.postMessage" || call.params.Get("text") != "pong" || call.params.Get("token") != "xoxb-test" {
+		t.Errorf("Unexpected reply: %s %s", call.method, call.params)
+	}
+}
+
+func TestSocketModeDispatch(t *testing.T) {
+	_, slack := startSocketModeBot(t)
+	server := <-slack.conns
+	defer server.Close()
+
+	sendEvent(t, server, "env1", "Ev1", "<@U0BOT> ping")
+	expectPong(t, slack)
+
+	// A retry of an event already delivered is acknowledged but not run again.
+	sendEvent(t, server, "env2", "Ev1", "<@U0BOT> ping")
+	sendEvent(t, server, "env3", "Ev2", "<@U0BOT> ping")
+	expectPong(t, slack)
+}
+
+func TestSocketModePreconnectsOnDisconnectWarning(t *testing.T) {
+	_, slack := startSocketModeBot(t)
+	old := <-slack.conns
+	defer old.Close()
+
+	old.WriteMessage(websocket.TextMessage, []byte(`{"type": "disconnect", "reason": "warning"}`))
+
+	if call := <-slack.calls; call.method != "apps.connections.open" {
+		t.Fatalf("Expected a new connection to be opened, got %s", call.method)
+	}
+	replacement := <-slack.conns
+	defer replacement.Close()
+
+	if _, _, err := old.ReadMessage(); err == nil {
+		t.Error("Expected the old connection to be closed")
+	}
+
+	sendEvent(t, replacement, "env1", "Ev1", "<@U0BOT> ping")
+	expectPong(t, slack)
+}
+
+func TestSocketModeRequiresAppToken(t *testing.T) {
+	if _, err := NewBot(WithToken("xoxb-test"), WithSocketMode("")); err == nil {
+		t.Error("Expected an error without an app token")
+	}
+}
@@ -0,0 +1,88 @@
+package gobot
+
+import (
+	"context"
+	"errors"
+)
+
+/*
+Transport connects a Bot to a chat service. The bot's core (commands,
+listeners, help, addressing and shutdown) only talks to its Transport, so
+the same bot can run over Slack's RTM websocket, the Events API, Socket
+Mode, or a different chat service altogether. See WithTransport.
+
+Connect is called once by Start. It establishes the connection and returns
+the identity the bot should answer to.
+
+Receive blocks until the next incoming message arrives or ctx is done.
+Transports that can recover from dropped connections should do so inside
+Receive; an error from Receive is taken to mean the connection is gone for
+good, and stops the bot. The exception is io.EOF, which means the input has
+simply run out: the bot finishes handling what it has already received and
+then shuts down gracefully.
+
+Send delivers msg, blocking until it has been handed off or ctx is done.
+It may be called from several goroutines at once.
+
+Close is called once by the bot as the last step of shutting down, after
+any outstanding sends have finished. Once Close is called, Receive should
+return ErrTransportClosed.
+
+A Transport may also implement Reactor and DirectMessenger to support the
+ResponseWriter methods of the same names.
+*/
+type Transport interface {
+	Connect(ctx context.Context) (*Identity, error)
+	Receive(ctx context.Context) (*IncomingMessage, error)
+	Send(ctx context.Context, msg *SlackMessage) error
+	Close() error
+}
+
+// Identity describes who a bot is on the service its Transport connects to.
+type Identity struct {
+	ID   string
+	Name string
+	Team string
+}
+
+/*
+Reactor is implemented by Transports that can add an emoji reaction to a
+message, identified by its channel and timestamp.
+*/
+type Reactor interface {
+	React(ctx context.Context, channel, ts, emoji string) error
+}
+
+/*
+DirectMessenger is implemented by Transports that can open a direct message
+conversation with a user, returning the channel to send it to.
+*/
+type DirectMessenger interface {
+	OpenDM(ctx context.Context, user string) (string, error)
+}
+
+// ErrTransportClosed is returned by Transport methods once the Transport is closed.
+var ErrTransportClosed = errors.New("Transport closed")
+
+var (
+	errNoReactions = errors.New("Transport does not support reactions")
+	errNoDMs       = errors.New("Transport does not support direct messages")
+)
+
+// react adds emoji to the message at ts in channel, if the transport supports it.
+func (b *Bot) react(ctx context.Context, channel, ts, emoji string) error {
+	r, ok := b.transport.(Reactor)
+	if !ok {
+		return errNoReactions
+	}
+	return r.React(ctx, channel, ts, emoji)
+}
+
+// openDM returns the direct message channel for user, if the transport supports it.
+func (b *Bot) openDM(ctx context.Context, user string) (string, error) {
+	dm, ok := b.transport.(DirectMessenger)
+	if !ok {
+		return "", errNoDMs
+	}
+	return dm.OpenDM(ctx, user)
+}
@@ -0,0 +1,145 @@
+/*
+Package transporttest checks the behaviour every gobot.Transport must share,
+so each transport's own tests can concentrate on its protocol:
+
+	func TestTransport(t *testing.T) {
+		transporttest.Run(t, func(t *testing.T) *transporttest.Fixture {
+			server := newFakeServer(t)
+			transport := connect(t, server)
+			return &transporttest.Fixture{
+				Transport: transport,
+				Deliver:   func(text string) { server.say(text) },
+				Sent:      func() string { return server.nextPost().Text },
+				Drop:      server.hangUp,
+			}
+		})
+	}
+
+Run calls the connect function once per check, so each gets a fresh
+transport and server.
+*/
+package transporttest
+
+import (
+	"context"
+	"github.com/jlindsey/gobot"
+	"testing"
+	"time"
+)
+
+// receiveTimeout bounds how long a check waits for a delivered message.
+const receiveTimeout = 5 * time.Second
+
+// Fixture is a connected transport and the means to drive the server at the other end.
+type Fixture struct {
+	// Transport has been connected. Run closes it when the check ends.
+	Transport gobot.Transport
+	// Deliver has the server send text as a message from some user, for Transport to receive.
+	Deliver func(text string)
+	// Sent waits for the next message Transport sends and returns its text. It's nil if sends can't be seen.
+	Sent func() string
+	/*
+		Drop ends the current connection from the server's side, the way a
+		network failure would, and returns once the transport has connected
+		again. It's nil for transports that don't reconnect.
+	*/
+	Drop func()
+}
+
+// Run checks the transport connect returns, calling it afresh for each check.
+func Run(t *testing.T, connect func(t *testing.T) *Fixture) {
+	t.Run("Receive", func(t *testing.T) {
+		f := connect(t)
+		defer f.Transport.Close()
+
+		f.Deliver("hello")
+		expectText(t, f.Transport, "hello")
+	})
+
+	t.Run("Send", func(t *testing.T) {
+		f := connect(t)
+		defer f.Transport.Close()
+		if f.Sent == nil {
+			t.Skip("Sends can't be seen")
+		}
+
+		// Reply where the message came from, so the channel is one the server knows.
+		f.Deliver("hello")
+		msg := expectText(t, f.Transport, "hello")
+		ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+		defer cancel()
+		if err := f.Transport.Send(ctx, gobot.NewSlackMessage(msg.Channel, "hi there")); err != nil {
+			t.Fatalf("Unexpected error sending: %s", err)
+		}
+		expectSent(t, f, "hi there")
+	})
+
+	t.Run("ReceiveHonoursContext", func(t *testing.T) {
+		f := connect(t)
+		defer f.Transport.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := f.Transport.Receive(ctx); err != context.Canceled {
+			t.Errorf("Expected Receive to return context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("ReceiveAfterClose", func(t *testing.T) {
+		f := connect(t)
+		if err := f.Transport.Close(); err != nil {
+			t.Errorf("Unexpected error closing: %s", err)
+		}
+		f.Transport.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+		defer cancel()
+		if _, err := f.Transport.Receive(ctx); err != gobot.ErrTransportClosed {
+			t.Errorf("Expected ErrTransportClosed, got %v", err)
+		}
+	})
+
+	t.Run("ReceiveAfterReconnecting", func(t *testing.T) {
+		f := connect(t)
+		defer f.Transport.Close()
+		if f.Drop == nil {
+			t.Skip("Transport doesn't reconnect")
+		}
+
+		f.Drop()
+		f.Deliver("still here")
+		expectText(t, f.Transport, "still here")
+	})
+}
+
+// expectText receives the next message from transport and checks its text.
+func expectText(t *testing.T, transport gobot.Transport, text string) *gobot.IncomingMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), receiveTimeout)
+	defer cancel()
+
+	msg, err := transport.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Expected %q, got error %s", text, err)
+	}
+	if msg.Text != text {
+		t.Errorf("Expected %q, got %q", text, msg.Text)
+	}
+	return msg
+}
+
+// expectSent waits for the server to see a message from the transport and checks its text.
+func expectSent(t *testing.T, f *Fixture, text string) {
+	t.Helper()
+	sent := make(chan string, 1)
+	go func() { sent <- f.Sent() }()
+
+	select {
+	case got := <-sent:
+		if got != text {
+			t.Errorf("Expected to send %q, got %q", text, got)
+		}
+	case <-time.After(receiveTimeout):
+		t.Fatalf("Timed out waiting for %q to be sent", text)
+	}
+}
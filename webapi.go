@@ -0,0 +1,213 @@
+package gobot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Jeffail/gabs"
+	"github.com/op/go-logging"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// webAPISendTimeout bounds queued chat.postMessage calls, which outlive the bot's context during shutdown.
+const webAPISendTimeout = 30 * time.Second
+
+/*
+slackClient calls the Slack Web API with a bot token. It is shared by the
+Bot, for the Slack features it exposes directly, and by the Slack
+transports, which embed it to post messages, add reactions and open DMs.
+*/
+type slackClient struct {
+	token      string
+	baseURL    *url.URL
+	httpClient *http.Client
+	log        *logging.Logger
+}
+
+/*
+callAPI calls a Slack Web API method with the bot's token and returns the
+parsed response body. Transport failures are returned as *HTTPError and
+responses with "ok": false as *SlackError. A *MissingTokenError is returned
+if the bot has no token, as happens with non-Slack transports.
+*/
+func (c *slackClient) callAPI(ctx context.Context, method string, params url.Values) (*gabs.Container, error) {
+	return c.callAPIWithToken(ctx, c.token, method, params)
+}
+
+// callAPIWithToken is callAPI with a token other than the bot's own, such as a Socket Mode app token.
+func (c *slackClient) callAPIWithToken(ctx context.Context, token, method string, params url.Values) (*gabs.Container, error) {
+	if token == "" {
+		return nil, &MissingTokenError{apiTokenEnvKey}
+	}
+
+	postVars := url.Values{}
+	for k, v := range params {
+		postVars[k] = v
+	}
+	postVars.Set("token", token)
+
+	endpoint := c.apiURL(method)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(postVars.Encode()))
+	if err != nil {
+		return nil, &HTTPError{Endpoint: endpoint, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, &HTTPError{Endpoint: endpoint, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+	}
+
+	rawBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Err: err}
+	}
+
+	parsedBody, err := gabs.ParseJSON(rawBody)
+	if err != nil {
+		return nil, &HTTPError{Endpoint: endpoint, StatusCode: resp.StatusCode, Err: err}
+	}
+
+	if ok, _ := parsedBody.Path("ok").Data().(bool); !ok {
+		slackErr, _ := parsedBody.Path("error").Data().(string)
+		return nil, &SlackError{Method: method, Message: slackErr}
+	}
+
+	return parsedBody, nil
+}
+
+// apiURL returns the full URL of the given Web API method.
+func (c *slackClient) apiURL(method string) string {
+	u := *c.baseURL
+	u.Path += method
+	return u.String()
+}
+
+// React adds the named emoji reaction to the message at ts in channel.
+func (c *slackClient) React(ctx context.Context, channel, ts, name string) error {
+	params := url.Values{}
+	params.Set("channel", channel)
+	params.Set("timestamp", ts)
+	params.Set("name", strings.Trim(name, ":"))
+
+	_, err := c.callAPI(ctx, "reactions.add", params)
+	return err
+}
+
+// OpenDM returns the ID of the direct message channel with user, opening it if needed.
+func (c *slackClient) OpenDM(ctx context.Context, user string) (string, error) {
+	params := url.Values{}
+	params.Set("users", user)
+
+	resp, err := c.callAPI(ctx, "conversations.open", params)
+	if err != nil {
+		return "", err
+	}
+
+	channel, _ := resp.Path("channel.id").Data().(string)
+	return channel, nil
+}
+
+/*
+PostMessage sends msg with the chat.postMessage Web API method and returns
+the timestamp Slack assigned to it. Unlike queued messages, which only use
+the Web API when they need to, PostMessage always does.
+*/
+func (b *Bot) PostMessage(ctx context.Context, msg *SlackMessage) (string, error) {
+	return b.api.postMessage(ctx, msg)
+}
+
+func (c *slackClient) postMessage(ctx context.Context, msg *SlackMessage) (string, error) {
+	params := url.Values{}
+	params.Set("channel", msg.Channel)
+	params.Set("text", msg.Text)
+
+	if msg.ThreadTS != "" {
+		params.Set("thread_ts", msg.ThreadTS)
+		if msg.ReplyBroadcast {
+			params.Set("reply_broadcast", "true")
+		}
+	}
+	if msg.Blocks != nil {
+		blocks, err := json.Marshal(msg.Blocks)
+		if err != nil {
+			return "", err
+		}
+		params.Set("blocks", string(blocks))
+	}
+	if len(msg.Attachments) > 0 {
+		attachments, err := json.Marshal(msg.Attachments)
+		if err != nil {
+			return "", err
+		}
+		params.Set("attachments", string(attachments))
+	}
+	if msg.Username != "" {
+		params.Set("username", msg.Username)
+	}
+	if msg.IconEmoji != "" {
+		params.Set("icon_emoji", msg.IconEmoji)
+	}
+	if msg.IconURL != "" {
+		params.Set("icon_url", msg.IconURL)
+	}
+	if msg.NoUnfurl {
+		params.Set("unfurl_links", "false")
+		params.Set("unfurl_media", "false")
+	}
+
+	resp, err := c.callAPI(ctx, "chat.postMessage", params)
+	if err != nil {
+		return "", err
+	}
+
+	ts, _ := resp.Path("ts").Data().(string)
+	return ts, nil
+}
+
+// postQueuedMessage sends a message taken from the send queue.
+func (c *slackClient) postQueuedMessage(ctx context.Context, msg *SlackMessage) error {
+	ctx, cancel := context.WithTimeout(ctx, webAPISendTimeout)
+	defer cancel()
+
+	c.log.Debugf("Posting message via Web API: %s", msg)
+	_, err := c.postMessage(ctx, msg)
+	return err
+}
+
+/*
+postResponseURL posts a JSON payload to a response_url given to us by an
+interaction or slash command.
+*/
+func (c *slackClient) postResponseURL(ctx context.Context, responseURL string, payload map[string]interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", responseURL, bytes.NewReader(body))
+	if err != nil {
+		return &HTTPError{Endpoint: responseURL, Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &HTTPError{Endpoint: responseURL, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{Endpoint: responseURL, StatusCode: resp.StatusCode}
+	}
+	return nil
+}
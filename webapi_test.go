@@ -0,0 +1,86 @@
+package gobot
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"regexp"
+	"testing"
+)
+
+func TestPostMessage(t *testing.T) {
+	slack := newFakeSlack(t)
+	slack.responses["chat.postMessage"] = map[string]interface{}{"ok": true, "ts": "123.456"}
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := NewSlackMessage("C1", "fallback")
+	msg.ThreadTS = "1.0"
+	msg.Blocks = []map[string]interface{}{{"type": "divider"}}
+	msg.Attachments = []Attachment{{Color: "good", Fields: []AttachmentField{{Title: "a", Value: "b", Short: true}}}}
+	msg.IconEmoji = ":robot_face:"
+	msg.NoUnfurl = true
+
+	ts, err := b.PostMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts != "123.456" {
+		t.Errorf("Expected ts 123.456, got %q", ts)
+	}
+
+	call := <-slack.calls
+	p := call.params
+	if call.method != "chat.postMessage" || p.Get("token") != "xoxb-test" || p.Get("channel") != "C1" ||
+		p.Get("text") != "fallback" || p.Get("thread_ts") != "1.0" || p.Get("icon_emoji") != ":robot_face:" ||
+		p.Get("unfurl_links") != "false" {
+		t.Errorf("Unexpected chat.postMessage params: %v", p)
+	}
+	if p.Get("blocks") != `[{"type":"divider"}]` {
+		t.Errorf("Unexpected blocks: %s", p.Get("blocks"))
+	}
+
+	var attachments []Attachment
+	if err = json.Unmarshal([]byte(p.Get("attachments")), &attachments); err != nil || attachments[0].Color != "good" {
+		t.Errorf("Unexpected attachments: %s", p.Get("attachments"))
+	}
+}
+
+func TestSendPicksTransport(t *testing.T) {
+	slack := newFakeSlack(t)
+
+	b, err := NewBot(slack.options()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.RegisterHandler(regexp.MustCompile(`^report$`), "", HandlerFunc(func(w ResponseWriter, r *Request) error {
+		rich := NewSlackMessage(r.Channel, "report")
+		rich.Attachments = []Attachment{{Text: "all good"}}
+		if err := w.Send(rich); err != nil {
+			return err
+		}
+		return w.Reply("plain")
+	}))
+
+	go b.Start(context.Background())
+	defer b.Stop()
+	server := <-slack.conns
+	defer server.Close()
+
+	server.WriteMessage(websocket.TextMessage, []byte(`{"type": "message", "channel": "C1", "text": "<@U0BOT> report"}`))
+
+	if call := <-slack.calls; call.method != "chat.postMessage" || call.params.Get("text") != "report" {
+		t.Errorf("Expected the rich message via the Web API, got %+v", call)
+	}
+
+	var reply map[string]interface{}
+	if err = server.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply["text"] != "plain" {
+		t.Errorf("Expected the plain reply via RTM, got %v", reply)
+	}
+}
@@ -0,0 +1,203 @@
+package gobot
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// closeHandshakeTimeout bounds how long Close waits for Slack to answer its close frame.
+const closeHandshakeTimeout = time.Second
+
+// socketConfig holds the settings shared by the websocket-based Slack transports.
+type socketConfig struct {
+	dialer          *websocket.Dialer
+	pingInterval    time.Duration
+	maxMissedPongs  int
+	reconnectPolicy ReconnectPolicy
+}
+
+/*
+slackSocket manages the websocket of the RTM and Socket Mode transports: it
+keeps track of the current connection, reconnects when it drops, and closes
+it gracefully. The transports embed it and supply the reader and dialer.
+*/
+type slackSocket struct {
+	*slackClient
+	socketConfig
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	connected chan struct{}
+	closed    bool
+	writeMu   sync.Mutex
+
+	incoming  chan *IncomingMessage
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	stopped   chan struct{}
+	err       error
+}
+
+func newSlackSocket(api *slackClient, cfg socketConfig) slackSocket {
+	ctx, cancel := context.WithCancel(context.Background())
+	return slackSocket{
+		slackClient:  api,
+		socketConfig: cfg,
+		connected:    make(chan struct{}),
+		incoming:     make(chan *IncomingMessage),
+		ctx:          ctx,
+		cancel:       cancel,
+		stopped:      make(chan struct{}),
+	}
+}
+
+func (s *slackSocket) dial(socketURL *url.URL) (*websocket.Conn, error) {
+	s.log.Infof("Dailing Slack at %s", socketURL.String())
+	conn, _, err := s.dialer.Dial(socketURL.String(), nil)
+	if err != nil {
+		return nil, &DialError{URL: socketURL.String(), Err: err}
+	}
+	return conn, nil
+}
+
+/*
+current returns the connection in use, or nil while reconnecting along with
+a channel that is closed once a connection is available again.
+*/
+func (s *slackSocket) current() (*websocket.Conn, chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn, s.connected
+}
+
+// setConn makes conn the connection in use. It reports false if the socket has been closed.
+func (s *slackSocket) setConn(conn *websocket.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conn != nil && s.closed {
+		return false
+	}
+	switch {
+	case conn != nil && s.conn == nil:
+		close(s.connected)
+	case conn == nil && s.conn != nil:
+		s.connected = make(chan struct{})
+	}
+	s.conn = conn
+	return true
+}
+
+/*
+dropConn stops using conn after a write to it has failed, and closes it so
+that its reader fails too and the socket reconnects. It does nothing to a
+connection that has already been replaced.
+*/
+func (s *slackSocket) dropConn(conn *websocket.Conn) {
+	s.mu.Lock()
+	if s.conn == conn {
+		s.conn = nil
+		s.connected = make(chan struct{})
+	}
+	s.mu.Unlock()
+	conn.Close()
+}
+
+/*
+run reads from conn until the socket is closed, replacing the connection
+whenever it drops. read returns when its connection fails; if it has already
+opened a replacement it returns that instead of an error. Otherwise
+redial is retried according to the reconnect policy, and run
+gives up once the policy's attempts are exhausted.
+*/
+func (s *slackSocket) run(conn *websocket.Conn, read func(*websocket.Conn) (*websocket.Conn, error), redial func() (*websocket.Conn, error)) {
+	defer close(s.stopped)
+
+	for {
+		next, err := read(conn)
+		if s.ctx.Err() != nil {
+			if next != nil {
+				next.Close()
+			}
+			s.err = ErrTransportClosed
+			return
+		}
+
+		if next == nil {
+			s.log.Warningf("Lost connection to Slack: %s", err)
+			s.setConn(nil)
+			err = s.reconnectPolicy.Retry(s.ctx.Done(), s.log, func(int) (err error) {
+				next, err = redial()
+				return err
+			})
+			if err != nil {
+				s.err = err
+				return
+			}
+			s.log.Info("Reconnected to Slack")
+		}
+
+		if !s.setConn(next) {
+			next.Close()
+			s.err = ErrTransportClosed
+			return
+		}
+		conn = next
+	}
+}
+
+// deliver passes msg on to Receive, dropping it if the socket is closing.
+func (s *slackSocket) deliver(msg *IncomingMessage) {
+	select {
+	case s.incoming <- msg:
+	case <-s.ctx.Done():
+	}
+}
+
+// Receive implements Transport.
+func (s *slackSocket) Receive(ctx context.Context) (*IncomingMessage, error) {
+	select {
+	case msg := <-s.incoming:
+		return msg, nil
+	case <-s.stopped:
+		return nil, s.err
+	case <-s.ctx.Done():
+		return nil, ErrTransportClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+Close implements Transport. It writes a close frame and waits briefly for
+Slack to acknowledge it before closing the connection.
+*/
+func (s *slackSocket) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		conn := s.conn
+		s.mu.Unlock()
+
+		s.cancel()
+		if conn == nil {
+			return
+		}
+
+		s.writeMu.Lock()
+		err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		s.writeMu.Unlock()
+		if err == nil {
+			select {
+			case <-s.stopped:
+			case <-time.After(closeHandshakeTimeout):
+			}
+		}
+		conn.Close()
+	})
+	return nil
+}